@@ -0,0 +1,603 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"klms-go/internal/browser"
+	"klms-go/internal/config"
+	"klms-go/internal/diff"
+	"klms-go/internal/ics"
+	"klms-go/internal/lock"
+	"klms-go/internal/notify"
+	"klms-go/internal/ocr"
+	"klms-go/internal/reminder"
+	"klms-go/internal/storage"
+)
+
+// command はサブコマンドです
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+// commands はサブコマンドの一覧です（usage の表示順）
+var commands = []command{
+	{"run", "[--dry-run]  K-LMSを1回チェックして通知します（引数なしと同じ）", cmdRun},
+	{"daemon", "[--dry-run]  常駐して定期的にチェックします", cmdDaemon},
+	{"history", "list | forget <キー>|--all  既知の課題の記録を表示・削除します", cmdHistory},
+	{"notify", "test [--channel 名前]  通知チャネルにテストメッセージを送ります", cmdNotify},
+	{"ocr", "[--backend gemini|tesseract|openai] <画像.png>  画像をOCRで読み取り、結果を表示します", cmdOCR},
+	{"ics", "export [-o ファイル]  既知の課題をカレンダーファイルに書き出します", cmdICS},
+	{"serve", "購読用のカレンダーを配信します（CALENDAR_FEED_ADDR・CALENDAR_FEED_TOKEN）", cmdServe},
+	{"caldav", "sync  既知の課題をCalDAVのカレンダーに今すぐ反映します", cmdCalDAV},
+	{"login", "check  K-LMSにログインできるか確認します", cmdLogin},
+	{"status", "API・送信の使用回数や前回の実行状況を表示します", cmdStatus},
+}
+
+// runCLI はサブコマンドを実行し、終了コードを返します
+func runCLI(args []string) int {
+	// 引数なし、またはフラグから始まる場合は run（例: klms-go --dry-run）
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		return cmdRun(args)
+	}
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return 0
+	}
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "不明なコマンドです: %s\n\n", name)
+	printUsage()
+	return 2
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "使い方: klms-go [コマンド] [引数]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "コマンド:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.usage)
+	}
+}
+
+// newFlagSet はサブコマンド用のフラグセットを作ります
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// loadConfigLenient は設定を読み込みます
+// run 以外のコマンドでは一部の設定が欠けていても使えるよう、検証エラーは警告に留めます
+func loadConfigLenient() *config.Config {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Printf("⚠️ 設定に不足があります: %v", err)
+	}
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	storage.ConfigureQuotas(cfg.Quotas())
+	return cfg
+}
+
+func cmdRun(args []string) int {
+	fs := newFlagSet("run")
+	fs.BoolVar(&dryRun, "dry-run", false, "通知を送らずに標準出力へ表示し、状態ファイルを更新しない")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	// データベースの移行やアウトボックスの読み込みは、他の実行が終わってから行う
+	runLock, err := lock.Acquire(lock.RunLockFile, "run", runLockWait())
+	if err != nil {
+		// タスクスケジューラーで前回の実行と重なるのは通常のことなので、エラーにはしない
+		log.Printf("⏭️ %v。今回の実行はスキップします", err)
+		return 0
+	}
+	defer runLock.Release()
+	cfg, src, ok := setupMonitor()
+	if !ok {
+		return 1
+	}
+	runOnce(cfg, src, browser.CheckKLMSTask)
+	return 0
+}
+
+func cmdDaemon(args []string) int {
+	fs := newFlagSet("daemon")
+	fs.BoolVar(&dryRun, "dry-run", false, "通知を送らずに標準出力へ表示し、状態ファイルを更新しない")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	// 常駐モードは起動している間ずっとロックを持つため、その間の run は実行されません
+	runLock, err := lock.Acquire(lock.RunLockFile, "daemon", runLockWait())
+	if err != nil {
+		log.Printf("❌ 常駐モードを開始できません: %v", err)
+		return 1
+	}
+	defer runLock.Release()
+	cfg, src, ok := setupMonitor()
+	if !ok {
+		return 1
+	}
+	runDaemon(cfg, src)
+	return 0
+}
+
+// runLockWait は実行ロックを待つ時間を返します
+// ロックは設定の検証より前に取得するため、設定のエラーはここでは報告しません（setupMonitor で報告する）
+func runLockWait() time.Duration {
+	cfg, _ := config.LoadConfig()
+	if cfg == nil {
+		return 0
+	}
+	return cfg.RunLockWait
+}
+
+// acquireCommandLock は共有の状態（データベース・ログインセッション）を変更するコマンドの実行ロックを取得します
+// 取得できなければエラーを表示して nil を返します
+func acquireCommandLock(command string, wait time.Duration) *lock.Lock {
+	l, err := lock.Acquire(lock.RunLockFile, command, wait)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return nil
+	}
+	return l
+}
+
+func cmdHistory(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "使い方: klms-go history list | forget <キー>|--all")
+		return 2
+	}
+	switch args[0] {
+	case "list":
+		return historyList(args[1:])
+	case "forget":
+		return historyForget(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "不明なサブコマンドです: history %s\n", args[0])
+	return 2
+}
+
+func historyList(args []string) int {
+	fs := newFlagSet("history list")
+	asJSON := fs.Bool("json", false, "JSONで出力する")
+	status := fs.String("status", "", "指定した状態の課題だけを表示する（open, submitted, removed, expired）")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	history, err := storage.LoadHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "課題の記録の読み込みエラー: %v\n", err)
+		return 1
+	}
+	records := []*storage.Record{}
+	for _, r := range history.List() {
+		if *status == "" || string(r.Status) == *status {
+			records = append(records, r)
+		}
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(records, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+	if len(records) == 0 {
+		fmt.Println("既知の課題はありません")
+		return 0
+	}
+	for _, r := range records {
+		fmt.Printf("%s %s  %s  %s / %s\n", statusMarks[r.Status], r.Key, r.Deadline, r.Course, r.Title)
+		detail := fmt.Sprintf("初回 %s・最終 %s", r.FirstSeen.Format("01/02 15:04"), r.LastSeen.Format("01/02 15:04"))
+		if r.NotifiedAt != nil {
+			detail += fmt.Sprintf("・通知 %s", r.NotifiedAt.Format("01/02 15:04"))
+		}
+		if r.Source != "" {
+			detail += fmt.Sprintf("・取得元 %s", r.Source)
+		}
+		fmt.Printf("    %s\n", detail)
+		for _, d := range r.DeadlineHistory {
+			fmt.Printf("    以前の期限: %s（%s に変更）\n", d.Deadline, d.ChangedAt.Format("01/02 15:04"))
+		}
+	}
+	return 0
+}
+
+// quotaNames は status で表示するサービス名です
+var quotaNames = map[storage.Quota]string{
+	storage.QuotaGemini: "Gemini",
+	storage.QuotaLine:   "LINE",
+	storage.QuotaGmail:  "Gmail",
+}
+
+// statusMarks は history list で状態を表す記号です
+var statusMarks = map[storage.Status]string{
+	storage.StatusOpen:      "・",
+	storage.StatusSubmitted: "✓",
+	storage.StatusRemoved:   "✗",
+	storage.StatusExpired:   "⌛",
+}
+
+func historyForget(args []string) int {
+	fs := newFlagSet("history forget")
+	all := fs.Bool("all", false, "すべての記録を削除する")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !*all && fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "使い方: klms-go history forget <キー>... | --all")
+		return 2
+	}
+	runLock := acquireCommandLock("history forget", runLockWait())
+	if runLock == nil {
+		return 1
+	}
+	defer runLock.Release()
+
+	items, err := diff.LoadSnapshot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "課題一覧の読み込みエラー: %v\n", err)
+		return 1
+	}
+	history, err := storage.LoadHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "送信履歴の読み込みエラー: %v\n", err)
+		return 1
+	}
+	fired := reminder.LoadFired()
+
+	if *all {
+		if err := forgetCommit(nil, &storage.History{Records: map[string]*storage.Record{}}, reminder.Fired{}); err != nil {
+			fmt.Fprintf(os.Stderr, "保存エラー: %v\n", err)
+			return 1
+		}
+		fmt.Printf("🗑️ %d 件の課題の記録をすべて削除しました\n", len(history.Records))
+		return 0
+	}
+
+	forget := map[string]bool{}
+	for _, key := range fs.Args() {
+		forget[key] = true
+	}
+	var kept []diff.Item
+	for _, item := range items {
+		if !forget[item.Key] {
+			kept = append(kept, item)
+		}
+	}
+	found := false
+	for _, key := range fs.Args() {
+		// 一覧から消えた・期限切れの課題は記録にだけ残っている
+		r := history.Get(key)
+		if !history.Remove(key) && !containsKey(items, key) {
+			fmt.Fprintf(os.Stderr, "⚠️ 見つかりませんでした: %s\n", key)
+			continue
+		}
+		fired.Forget(key)
+		found = true
+		if r == nil {
+			fmt.Printf("🗑️ %s を削除しました\n", key)
+			continue
+		}
+		fmt.Printf("🗑️ %s（%s / %s）を削除しました\n", key, r.Course, r.Title)
+	}
+	if !found {
+		return 1
+	}
+
+	if err := forgetCommit(kept, history, fired); err != nil {
+		fmt.Fprintf(os.Stderr, "保存エラー: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// containsKey は課題一覧に key の課題があるかを返します
+func containsKey(items []diff.Item, key string) bool {
+	for _, item := range items {
+		if item.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetCommit は課題一覧・課題の記録・リマインダーの記録をまとめて保存します
+// 次回のチェックで差分を取り直すため、前回のフィンガープリントも消します
+func forgetCommit(items []diff.Item, history *storage.History, fired reminder.Fired) error {
+	return storage.Update(func(tx storage.Tx) error {
+		if err := diff.PutSnapshot(tx, items); err != nil {
+			return err
+		}
+		if err := history.Put(tx); err != nil {
+			return err
+		}
+		if err := fired.Put(tx); err != nil {
+			return err
+		}
+		return tx.Delete(storage.BucketState, storage.KeyLastFingerprint)
+	})
+}
+
+func cmdNotify(args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(os.Stderr, "使い方: klms-go notify test [--channel 名前]")
+		return 2
+	}
+	fs := newFlagSet("notify test")
+	channel := fs.String("channel", "", "送信するチャネル（line, gmail, slack, discord, webhook。省略時は全チャネル）")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	// テスト送信はアウトボックスを使わない（失敗はその場で表示する）
+	registry := notify.NewRegistry(loadConfigLenient())
+	registry.RunID = newRunID()
+	if *channel != "" {
+		if registry.Get(*channel) == nil {
+			fmt.Fprintf(os.Stderr, "チャネル %s は設定されていません\n", *channel)
+			return 1
+		}
+		registry = registry.Only(*channel)
+	}
+
+	results := registry.Send(context.Background(), notify.Message{
+		Event:   notify.EventAssignmentsChanged,
+		Subject: "【K-LMS】テスト通知",
+		Body:    fmt.Sprintf("K-LMS監視システムからのテスト通知です。\n\n📅 送信時刻: %s", time.Now().Format("2006-01-02 15:04")),
+		Summary: "K-LMS監視システムからのテスト通知です。",
+	})
+	code := 0
+	if len(results) == 0 {
+		code = 1
+	}
+	for _, r := range results {
+		switch {
+		case r.Deferred():
+			// 届いていないので、テストとしては成功にしない
+			fmt.Printf("📪 %s: 送信せずに保留しました（%v）\n", r.Channel, r.Err)
+			code = 1
+		case r.Err != nil:
+			fmt.Printf("❌ %s: %v\n", r.Channel, r.Err)
+			code = 1
+		default:
+			fmt.Printf("✅ %s: 送信しました\n", r.Channel)
+		}
+	}
+	return code
+}
+
+func cmdOCR(args []string) int {
+	fs := newFlagSet("ocr")
+	asJSON := fs.Bool("json", false, "抽出した課題をJSONで出力する")
+	backend := fs.String("backend", "gemini", "読み取りに使うOCR（gemini, tesseract, openai）")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "使い方: klms-go ocr [--json] [--backend gemini|tesseract|openai] <画像.png>")
+		return 2
+	}
+
+	var text string
+	var assignments []ocr.Assignment
+	var err error
+	switch *backend {
+	case "gemini":
+		text, assignments, err = ocr.ExtractAssignmentInfo(fs.Arg(0))
+	case "tesseract":
+		cfg := loadConfigLenient()
+		engine := &ocr.Tesseract{Path: cfg.TesseractPath, Language: cfg.TesseractLanguage}
+		text, assignments, err = engine.ExtractAssignments(context.Background(), fs.Arg(0))
+	case "openai":
+		cfg := loadConfigLenient()
+		engine := &ocr.OpenAICompatible{BaseURL: cfg.OpenAIBaseURL, Model: cfg.OpenAIModel, APIKey: cfg.OpenAIAPIKey}
+		text, assignments, err = engine.ExtractAssignments(context.Background(), fs.Arg(0))
+	default:
+		fmt.Fprintf(os.Stderr, "不明なOCRです: %s\n", *backend)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "OCRエラー: %v\n", err)
+		return 1
+	}
+	if *asJSON {
+		data, _ := json.MarshalIndent(assignments, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+	fmt.Println(text)
+	if assignments == nil {
+		fmt.Fprintln(os.Stderr, "⚠️ 課題を構造化できませんでした")
+	}
+	return 0
+}
+
+func cmdICS(args []string) int {
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprintln(os.Stderr, "使い方: klms-go ics export [-o ファイル]")
+		return 2
+	}
+	fs := newFlagSet("ics export")
+	out := fs.String("o", ScheduleFile, "出力先（- で標準出力）")
+	includeDone := fs.Bool("all", false, "完了済み・期限切れの課題も含める")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	items, err := diff.LoadSnapshot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "課題一覧の読み込みエラー: %v\n", err)
+		return 1
+	}
+	now := time.Now()
+	var exported []diff.Item
+	for _, item := range items {
+		if !*includeDone {
+			if item.Completed {
+				continue
+			}
+			if deadline, err := ocr.ParseDeadline(item.Deadline); err == nil && deadline.Before(now) {
+				continue
+			}
+		}
+		exported = append(exported, item)
+	}
+
+	content := ics.GenerateICS(exported, ics.NewOptions(loadConfigLenient()))
+	if *out == "-" {
+		fmt.Print(content)
+		return 0
+	}
+	if err := ioutil.WriteFile(*out, []byte(content), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "書き込みエラー: %v\n", err)
+		return 1
+	}
+	fmt.Printf("📅 %d 件の課題を %s に書き出しました\n", len(exported), *out)
+	return 0
+}
+
+func cmdServe(args []string) int {
+	if err := newFlagSet("serve").Parse(args); err != nil {
+		return 2
+	}
+	cfg := loadConfigLenient()
+	if cfg.CalendarFeedAddr == "" || len(cfg.CalendarFeedToken) < 16 {
+		fmt.Fprintln(os.Stderr, "CALENDAR_FEED_ADDR と CALENDAR_FEED_TOKEN（16文字以上）を設定してください")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := newFeedServer(cfg).ListenAndServe(ctx, cfg.CalendarFeedAddr); err != nil {
+		fmt.Fprintf(os.Stderr, "カレンダー配信エラー: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func cmdCalDAV(args []string) int {
+	if len(args) == 0 || args[0] != "sync" {
+		fmt.Fprintln(os.Stderr, "使い方: klms-go caldav sync")
+		return 2
+	}
+	if err := newFlagSet("caldav sync").Parse(args[1:]); err != nil {
+		return 2
+	}
+	cfg := loadConfigLenient()
+	if cfg.CalDAVURL == "" {
+		fmt.Fprintln(os.Stderr, "CALDAV_URL が設定されていません")
+		return 1
+	}
+	runLock := acquireCommandLock("caldav sync", cfg.RunLockWait)
+	if runLock == nil {
+		return 1
+	}
+	defer runLock.Release()
+	if err := syncCalDAV(cfg, true); err != nil {
+		return 1
+	}
+	fmt.Println("✅ CalDAVへの反映が完了しました")
+	return 0
+}
+
+func cmdLogin(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "使い方: klms-go login check")
+		return 2
+	}
+	cfg := loadConfigLenient()
+	if cfg.KeioUser == "" || cfg.KeioPass == "" {
+		fmt.Fprintln(os.Stderr, "⚠️ KEIO_USER / KEIO_PASS が設定されていません（保存済みのセッションのみで確認します）")
+	}
+	// ログインセッション（ブラウザのプロファイル）を実行中の監視と同時に使わない
+	runLock := acquireCommandLock("login check", cfg.RunLockWait)
+	if runLock == nil {
+		return 1
+	}
+	defer runLock.Release()
+
+	session, err := browser.NewSession()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ブラウザ起動エラー: %v\n", err)
+		return 1
+	}
+	defer session.Close()
+
+	url, err := session.CheckLogin()
+	if err != nil {
+		fmt.Printf("❌ ログインできませんでした: %v\n（現在のURL: %s）\n", err, url)
+		return 1
+	}
+	fmt.Printf("✅ ログインできました: %s\n", url)
+	return 0
+}
+
+func cmdStatus(args []string) int {
+	if err := newFlagSet("status").Parse(args); err != nil {
+		return 2
+	}
+
+	loadConfigLenient()
+	usage := storage.LoadUsage()
+	fmt.Printf("📊 本日（%s）の使用回数\n", usage.Date)
+	for _, q := range storage.Quotas {
+		status := storage.QuotaStatusOf(q)
+		line := fmt.Sprintf("  %-7s %s", quotaNames[q]+":", status)
+		if q == storage.QuotaGmail && usage.GmailLimitNotified {
+			line += "（上限到達を通知済み）"
+		}
+		if q == storage.QuotaGmail {
+			if pending := notify.PendingGmail(); pending > 0 {
+				line += fmt.Sprintf("・保留中 %d 件", pending)
+			}
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("  次のリセット: %s\n", storage.QuotaStatusOf(storage.QuotaGemini).ResetAt.Format("2006-01-02 15:04"))
+
+	fmt.Println("")
+	if holder, err := lock.Status(lock.RunLockFile); err != nil {
+		fmt.Printf("🔒 実行状況: 不明（%v）\n", err)
+	} else if holder != nil {
+		fmt.Printf("🔒 実行中: %s\n", holder)
+	}
+	if lastRun, err := time.Parse(time.RFC3339, storage.GetState(storage.KeyLastRunAt)); err == nil {
+		fmt.Printf("🕒 前回の実行: %s\n", lastRun.Format("2006-01-02 15:04:05"))
+	} else {
+		fmt.Println("🕒 前回の実行: なし")
+	}
+	if history, err := storage.LoadHistory(); err == nil {
+		counts := map[storage.Status]int{}
+		for _, r := range history.Records {
+			counts[r.Status]++
+		}
+		fmt.Printf("📋 既知の課題: %d 件（未提出 %d・提出済み %d・削除 %d・期限切れ %d）\n", len(history.Records),
+			counts[storage.StatusOpen], counts[storage.StatusSubmitted], counts[storage.StatusRemoved], counts[storage.StatusExpired])
+	}
+	if outbox, err := notify.LoadOutbox(notify.OutboxDir); err == nil {
+		fmt.Printf("📮 未送信の通知: %d 件\n", len(outbox.Entries))
+		for _, e := range outbox.Entries {
+			fmt.Printf("  - %s「%s」 %d回失敗 次回 %s %s\n", e.Channel, e.Message.Subject, e.Attempts,
+				e.NextAttemptAt.Format("01/02 15:04"), strings.TrimSpace(e.LastError))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"klms-go/internal/browser"
+	"klms-go/internal/config"
+	"klms-go/internal/feed"
+	"klms-go/internal/ics"
+	"klms-go/internal/source"
+)
+
+// BrowserMaxAge はブラウザを起動し直すまでの時間です（長時間の起動によるメモリ増加を防ぐ）
+const BrowserMaxAge = 6 * time.Hour
+
+// runDaemon は常駐してチェックを繰り返します
+// Playwrightとブラウザは起動したまま使い回し、SIGTERM/Ctrl+Cを受けると実行中のチェックを終えてから終了します
+func runDaemon(cfg *config.Config, src source.AssignmentSource) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("🛎️ 常駐モードで起動しました（間隔: %v ± %v）", cfg.PollInterval, cfg.PollJitter)
+
+	// カレンダー配信（設定されている場合のみ）
+	if cfg.CalendarFeedAddr != "" {
+		go func() {
+			if err := newFeedServer(cfg).ListenAndServe(ctx, cfg.CalendarFeedAddr); err != nil {
+				log.Printf("⚠️ カレンダー配信エラー: %v", err)
+			}
+		}()
+	}
+
+	var session *browser.Session
+	var sessionStarted time.Time
+	defer func() {
+		session.Close()
+		log.Println("👋 常駐モードを終了しました")
+	}()
+
+	for {
+		now := time.Now()
+		if !cfg.IsActiveAt(now) {
+			log.Println("🌙 監視時間外のためスキップします")
+			// 時間外はブラウザを閉じておく
+			if session != nil {
+				session.Close()
+				session = nil
+			}
+		} else {
+			check := checkFunc(nil)
+			if cfg.NeedsBrowser() {
+				if session != nil && (!session.Alive() || now.Sub(sessionStarted) > BrowserMaxAge) {
+					log.Println("♻️ ブラウザを起動し直します")
+					session.Close()
+					session = nil
+				}
+				if session == nil {
+					s, err := browser.NewSession()
+					if err != nil {
+						log.Printf("⚠️ ブラウザの起動に失敗しました（次回再試行します）: %v", err)
+					} else {
+						session, sessionStarted = s, now
+					}
+				}
+				if session != nil {
+					check = session.Check
+				}
+			}
+			if check != nil || !cfg.NeedsBrowser() {
+				log.Println("------------------------------------------------")
+				log.Println("🚀 K-LMSチェックを開始します: ", now.Format("2006-01-02 15:04:05"))
+				runOnce(cfg, src, check)
+			}
+		}
+
+		wait := nextPollDelay(cfg)
+		log.Printf("💤 次のチェックまで %v 待機します", wait.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			log.Println("🛑 終了シグナルを受信しました")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// newFeedServer は保存済みの課題一覧を配信するサーバーを作ります
+func newFeedServer(cfg *config.Config) *feed.Server {
+	return &feed.Server{
+		Token:   cfg.CalendarFeedToken,
+		Options: ics.NewOptions(cfg),
+		Load:    feed.LoadSnapshot,
+	}
+}
+
+// nextPollDelay は次のチェックまでの待ち時間（間隔 ± 揺らぎ）を返します
+func nextPollDelay(cfg *config.Config) time.Duration {
+	wait := cfg.PollInterval
+	if cfg.PollJitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(2*cfg.PollJitter))) - cfg.PollJitter
+	}
+	if wait < time.Minute {
+		wait = time.Minute
+	}
+	return wait
+}
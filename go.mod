@@ -7,6 +7,8 @@ require github.com/joho/godotenv v1.5.1
 require (
 	github.com/google/generative-ai-go v0.20.1
 	github.com/playwright-community/playwright-go v0.5200.1
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/sys v0.37.0
 	google.golang.org/api v0.256.0
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
 )
@@ -38,7 +40,6 @@ require (
 	golang.org/x/net v0.46.0 // indirect
 	golang.org/x/oauth2 v0.33.0 // indirect
 	golang.org/x/sync v0.18.0 // indirect
-	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
 	golang.org/x/time v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20250804133106-a7a43d27e69b // indirect
@@ -3,6 +3,7 @@ package browser
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -14,9 +15,10 @@ import (
 
 // ファイルパス定義（フォルダ分け）
 const (
-	CookieFile     = "data/state.json"
-	DebugTextFile  = "logs/debug_last_text.txt"
-	ScreenshotFile = "data/screenshot.png"
+	CookieFile       = "data/state.json"
+	DebugTextFile    = "logs/debug_last_text.txt"
+	DebugPlannerFile = "logs/debug_planner.json"
+	ScreenshotFile   = "data/screenshot.png"
 )
 
 // 設定定数
@@ -31,10 +33,87 @@ type CheckResult struct {
 	Hash           string
 	ScreenshotPath string
 	HasDiff        bool
+	BodyText       string       // 監視対象要素のテキスト（InnerText）
+	PlannerDays    []PlannerDay // プランナーの構造化データ（リスト表示の場合のみ）
+}
+
+// Session は起動済みのPlaywright・ブラウザ・コンテキストです
+// 常駐モードでは1つのセッションを使い回して、チェックのたびにブラウザを起動する負荷を省きます
+type Session struct {
+	pw      *playwright.Playwright
+	browser playwright.Browser
+	context playwright.BrowserContext
+}
+
+// NewSession はPlaywrightとブラウザを起動し、保存済みのCookieでコンテキストを作成します
+func NewSession() (*Session, error) {
+	// フォルダが存在しないとエラーになる可能性があるので、念のため作成しておく
+	_ = os.MkdirAll("data", 0755)
+	_ = os.MkdirAll("logs", 0755)
+
+	pw, err := playwright.Run()
+	if err != nil {
+		return nil, fmt.Errorf("Playwright起動エラー: %v", err)
+	}
+	
+	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+		Headless: playwright.Bool(true), // デバッグ中はfalse推奨
+	})
+	if err != nil {
+		pw.Stop()
+		return nil, fmt.Errorf("ブラウザ起動エラー: %v", err)
+	}
+
+	// Cookie読み込み先を変更
+	contextOptions := playwright.BrowserNewContextOptions{}
+	if _, err := os.Stat(CookieFile); err == nil {
+		contextOptions.StorageStatePath = playwright.String(CookieFile)
+	}
+	
+	context, err := browser.NewContext(contextOptions)
+	if err != nil {
+		browser.Close()
+		pw.Stop()
+		return nil, fmt.Errorf("コンテキスト作成エラー: %v", err)
+	}
+	return &Session{pw: pw, browser: browser, context: context}, nil
+}
+
+// Close はブラウザとPlaywrightを終了します
+func (s *Session) Close() {
+	if s == nil {
+		return
+	}
+	s.browser.Close()
+	s.pw.Stop()
+}
+
+// Alive はブラウザが接続中かを返します（クラッシュした場合はfalse）
+func (s *Session) Alive() bool {
+	return s != nil && s.browser.IsConnected()
 }
 
 // CheckKLMSTask はK-LMSをチェックします（リトライ機能付き）
+// 試行ごとにブラウザを起動し直します
 func CheckKLMSTask(oldHash string) (*CheckResult, error) {
+	return checkWithRetry(oldHash, func(attempt int) (*CheckResult, error) {
+		session, err := NewSession()
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+		return session.checkOnce(oldHash, attempt)
+	})
+}
+
+// Check は起動済みのセッションでK-LMSをチェックします（リトライ機能付き）
+func (s *Session) Check(oldHash string) (*CheckResult, error) {
+	return checkWithRetry(oldHash, func(attempt int) (*CheckResult, error) {
+		return s.checkOnce(oldHash, attempt)
+	})
+}
+
+func checkWithRetry(oldHash string, check func(attempt int) (*CheckResult, error)) (*CheckResult, error) {
 	var lastErr error
 	
 	// リトライループ
@@ -44,7 +123,7 @@ func CheckKLMSTask(oldHash string) (*CheckResult, error) {
 			time.Sleep(RetryDelay)
 		}
 		
-		result, err := checkKLMSTaskOnce(oldHash, attempt)
+		result, err := check(attempt)
 		if err == nil {
 			return result, nil
 		}
@@ -63,47 +142,123 @@ func CheckKLMSTask(oldHash string) (*CheckResult, error) {
 	return nil, fmt.Errorf("最大リトライ回数（%d回）に達しました: %v", MaxRetries, lastErr)
 }
 
-// checkKLMSTaskOnce は1回のチェックを実行します
-func checkKLMSTaskOnce(oldHash string, attempt int) (*CheckResult, error) {
-	// フォルダが存在しないとエラーになる可能性があるので、念のため作成しておく
-	_ = os.MkdirAll("data", 0755)
-	_ = os.MkdirAll("logs", 0755)
-
-	pw, err := playwright.Run()
+// checkOnce は1回のチェックを実行します（ページはチェックごとに開いて閉じます）
+func (s *Session) checkOnce(oldHash string, attempt int) (*CheckResult, error) {
+	page, err := s.context.NewPage()
 	if err != nil {
-		return nil, fmt.Errorf("Playwright起動エラー: %v", err)
+		return nil, fmt.Errorf("ページ作成エラー: %v", err)
 	}
-	
-	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
-		Headless: playwright.Bool(true), // デバッグ中はfalse推奨
-	})
-	if err != nil {
-		return nil, fmt.Errorf("ブラウザ起動エラー: %v", err)
+	defer page.Close()
+
+	if err := s.openDashboard(page, attempt); err != nil {
+		return nil, err
 	}
-	defer browser.Close()
 
-	// Cookie読み込み先を変更
-	contextOptions := playwright.BrowserNewContextOptions{}
-	if _, err := os.Stat(CookieFile); err == nil {
-		contextOptions.StorageStatePath = playwright.String(CookieFile)
+	// ネットワークが落ち着くまで待機（タイムアウトを設定）
+	log.Println("⏳ ネットワークアイドル待機中...")
+	if err := page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{
+		State:   playwright.LoadStateNetworkidle,
+		Timeout: playwright.Float(NetworkIdleTimeout), // 30秒
+	}); err != nil {
+		log.Printf("⚠️ ネットワークアイドル待機タイムアウト（続行します）: %v", err)
+		// ネットワークアイドル待機のタイムアウトは致命的ではないので続行
 	}
+
+	// === ハッシュ化 ===
+	targetSelector := "#dashboard"
+	// カレンダー表示かリスト表示かを判定して対象を変えるロジック（そのまま維持）
+	if listItems, _ := page.QuerySelector(".planner-day"); listItems != nil {
+		targetSelector = "#dashboard-planner"
+	}
+
+	log.Printf("🎯 監視対象: %s", targetSelector)
 	
-	context, err := browser.NewContext(contextOptions)
+	// セレクタが存在するか確認
+	if _, err := page.QuerySelector(targetSelector); err != nil {
+		log.Printf("⚠️ 監視対象セレクタが見つかりません: %s", targetSelector)
+		// 代替セレクタを試す
+		if listItems, _ := page.QuerySelector(".planner-day"); listItems != nil {
+			targetSelector = "#dashboard-planner"
+			log.Printf("🔄 代替セレクタを使用: %s", targetSelector)
+		} else if dashboard, _ := page.QuerySelector("#dashboard"); dashboard != nil {
+			targetSelector = "#dashboard"
+			log.Printf("🔄 代替セレクタを使用: %s", targetSelector)
+		} else {
+			return nil, fmt.Errorf("監視対象セレクタが見つかりません: %s", targetSelector)
+		}
+	}
+	
+	bodyText, err := page.InnerText(targetSelector)
 	if err != nil {
-		return nil, fmt.Errorf("コンテキスト作成エラー: %v", err)
+		return nil, fmt.Errorf("テキスト取得エラー: %v", err)
+	}
+
+	// デバッグ用ログをlogsフォルダへ
+	ioutil.WriteFile(DebugTextFile, []byte(bodyText), 0644)
+
+	hashBytes := sha256.Sum256([]byte(bodyText))
+	newHash := hex.EncodeToString(hashBytes[:])
+	log.Printf("🔍 新ハッシュ: %s", newHash[:10])
+
+	if newHash == oldHash {
+		log.Println("🟦 変更なし")
+		return &CheckResult{Hash: newHash, HasDiff: false, BodyText: bodyText}, nil
+	}
+
+	// プランナーの構造を取り出す（リスト表示の場合のみ）
+	var plannerDays []PlannerDay
+	if targetSelector == "#dashboard-planner" {
+		if days, err := extractPlannerDays(page); err != nil {
+			log.Printf("⚠️ %v", err)
+		} else {
+			plannerDays = days
+			if data, err := json.MarshalIndent(days, "", "  "); err == nil {
+				ioutil.WriteFile(DebugPlannerFile, data, 0644)
+			}
+			log.Printf("🗂️ プランナーから %d 日分の項目を取得しました", len(days))
+		}
 	}
 
-	page, err := context.NewPage()
+	// スクショ保存先をdataフォルダへ
+	log.Println("🟥 変更検知！スクショを撮ります")
+	if _, err := page.Screenshot(playwright.PageScreenshotOptions{
+		Path:     playwright.String(ScreenshotFile),
+		FullPage: playwright.Bool(true),
+	}); err != nil {
+		return nil, fmt.Errorf("スクショ失敗: %v", err)
+	}
+
+	return &CheckResult{
+		Hash:           newHash,
+		ScreenshotPath: ScreenshotFile,
+		HasDiff:        true,
+		BodyText:       bodyText,
+		PlannerDays:    plannerDays,
+	}, nil
+}
+
+// CheckLogin はK-LMSにログインしてダッシュボードに到達できるかを確認し、到達したURLを返します
+func (s *Session) CheckLogin() (string, error) {
+	page, err := s.context.NewPage()
 	if err != nil {
-		return nil, fmt.Errorf("ページ作成エラー: %v", err)
+		return "", fmt.Errorf("ページ作成エラー: %v", err)
+	}
+	defer page.Close()
+
+	if err := s.openDashboard(page, 1); err != nil {
+		return page.URL(), err
 	}
+	return page.URL(), nil
+}
 
+// openDashboard はK-LMSを開き、必要ならログインして、ダッシュボードが表示されるまで待ちます
+func (s *Session) openDashboard(page playwright.Page, attempt int) error {
 	log.Println("🌐 アクセス中: https://lms.keio.jp")
 	if _, err := page.Goto("https://lms.keio.jp", playwright.PageGotoOptions{
 		WaitUntil: playwright.WaitUntilStateDomcontentloaded,
 		Timeout:   playwright.Float(60000), // 60秒タイムアウト
 	}); err != nil {
-		return nil, fmt.Errorf("ページ遷移エラー: %v", err)
+		return fmt.Errorf("ページ遷移エラー: %v", err)
 	}
 
 	// === ログイン処理 ===
@@ -116,7 +271,7 @@ func checkKLMSTaskOnce(oldHash string, attempt int) (*CheckResult, error) {
 		if _, err := page.WaitForSelector("input[type=\"text\"]", playwright.PageWaitForSelectorOptions{
 			Timeout: playwright.Float(30000), // 30秒
 		}); err != nil {
-			return nil, fmt.Errorf("ログインフォーム待機タイムアウト: %v", err)
+			return fmt.Errorf("ログインフォーム待機タイムアウト: %v", err)
 		}
 		
 		page.Fill("input[type=\"text\"]", os.Getenv("KEIO_USER"))
@@ -126,7 +281,7 @@ func checkKLMSTaskOnce(oldHash string, attempt int) (*CheckResult, error) {
 		if _, err := page.WaitForSelector("input[type=\"password\"]", playwright.PageWaitForSelectorOptions{
 			Timeout: playwright.Float(30000), // 30秒
 		}); err != nil {
-			return nil, fmt.Errorf("パスワード入力欄待機タイムアウト: %v", err)
+			return fmt.Errorf("パスワード入力欄待機タイムアウト: %v", err)
 		}
 		
 		page.Fill("input[type=\"password\"]", os.Getenv("KEIO_PASS"))
@@ -138,9 +293,9 @@ func checkKLMSTaskOnce(oldHash string, attempt int) (*CheckResult, error) {
 			State:   playwright.LoadStateDomcontentloaded,
 			Timeout: playwright.Float(60000), // 60秒
 		}); err != nil {
-			return nil, fmt.Errorf("ログイン後のページ読み込みタイムアウト: %v", err)
+			return fmt.Errorf("ログイン後のページ読み込みタイムアウト: %v", err)
 		}
-		context.StorageState(CookieFile) // 保存
+		s.context.StorageState(CookieFile) // 保存
 	}
 
 	// === ダッシュボード待機（複数のセレクタを試す） ===
@@ -192,72 +347,8 @@ func checkKLMSTaskOnce(oldHash string, attempt int) (*CheckResult, error) {
 			log.Printf("📄 デバッグ用HTMLを保存: %s", htmlDebugFile)
 		}
 		
-		return nil, fmt.Errorf("ダッシュボード到達タイムアウト（試行 %d回目）: %v", attempt, lastSelectorErr)
-	}
-
-	// ネットワークが落ち着くまで待機（タイムアウトを設定）
-	log.Println("⏳ ネットワークアイドル待機中...")
-	if err := page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{
-		State:   playwright.LoadStateNetworkidle,
-		Timeout: playwright.Float(NetworkIdleTimeout), // 30秒
-	}); err != nil {
-		log.Printf("⚠️ ネットワークアイドル待機タイムアウト（続行します）: %v", err)
-		// ネットワークアイドル待機のタイムアウトは致命的ではないので続行
-	}
-
-	// === ハッシュ化 ===
-	targetSelector := "#dashboard"
-	// カレンダー表示かリスト表示かを判定して対象を変えるロジック（そのまま維持）
-	if listItems, _ := page.QuerySelector(".planner-day"); listItems != nil {
-		targetSelector = "#dashboard-planner"
+		return fmt.Errorf("ダッシュボード到達タイムアウト（試行 %d回目）: %v", attempt, lastSelectorErr)
 	}
 
-	log.Printf("🎯 監視対象: %s", targetSelector)
-	
-	// セレクタが存在するか確認
-	if _, err := page.QuerySelector(targetSelector); err != nil {
-		log.Printf("⚠️ 監視対象セレクタが見つかりません: %s", targetSelector)
-		// 代替セレクタを試す
-		if listItems, _ := page.QuerySelector(".planner-day"); listItems != nil {
-			targetSelector = "#dashboard-planner"
-			log.Printf("🔄 代替セレクタを使用: %s", targetSelector)
-		} else if dashboard, _ := page.QuerySelector("#dashboard"); dashboard != nil {
-			targetSelector = "#dashboard"
-			log.Printf("🔄 代替セレクタを使用: %s", targetSelector)
-		} else {
-			return nil, fmt.Errorf("監視対象セレクタが見つかりません: %s", targetSelector)
-		}
-	}
-	
-	bodyText, err := page.InnerText(targetSelector)
-	if err != nil {
-		return nil, fmt.Errorf("テキスト取得エラー: %v", err)
-	}
-
-	// デバッグ用ログをlogsフォルダへ
-	ioutil.WriteFile(DebugTextFile, []byte(bodyText), 0644)
-
-	hashBytes := sha256.Sum256([]byte(bodyText))
-	newHash := hex.EncodeToString(hashBytes[:])
-	log.Printf("🔍 新ハッシュ: %s", newHash[:10])
-
-	if newHash == oldHash {
-		log.Println("🟦 変更なし")
-		return &CheckResult{Hash: newHash, HasDiff: false}, nil
-	}
-
-	// スクショ保存先をdataフォルダへ
-	log.Println("🟥 変更検知！スクショを撮ります")
-	if _, err := page.Screenshot(playwright.PageScreenshotOptions{
-		Path:     playwright.String(ScreenshotFile),
-		FullPage: playwright.Bool(true),
-	}); err != nil {
-		return nil, fmt.Errorf("スクショ失敗: %v", err)
-	}
-
-	return &CheckResult{
-		Hash:           newHash,
-		ScreenshotPath: ScreenshotFile,
-		HasDiff:        true,
-	}, nil
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,77 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// PlannerDay はダッシュボードのプランナーの1日分（.planner-day）です
+type PlannerDay struct {
+	Heading string        `json:"heading"` // 日付見出し（例: 「1月13日 火曜日」「今日」）
+	Items   []PlannerItem `json:"items"`
+}
+
+// PlannerItem はプランナーの1項目です
+// 値はDOMから取り出した文字列のままで、解釈は source パッケージで行います
+type PlannerItem struct {
+	Course    string `json:"course"`    // グループ見出しのコース名
+	Title     string `json:"title"`     // 課題名
+	Type      string `json:"type"`      // 種別ラベル（例: 「課題」「小テスト」）
+	URL       string `json:"url"`       // 課題ページのURL
+	Due       string `json:"due"`       // 期限の表示（例: 「期限: 23:59」）
+	Completed bool   `json:"completed"` // チェックボックスが付いているか
+}
+
+// plannerScript は .planner-day 要素を走査して項目を取り出すスクリプトです
+// CanvasのCSSクラス名はビルドごとに接尾辞が変わるため、部分一致で探します
+const plannerScript = `(days) => {
+	const text = (el) => el ? el.innerText.replace(/\s+/g, ' ').trim() : '';
+	const first = (root, selectors) => {
+		for (const s of selectors) {
+			const el = root.querySelector(s);
+			if (el) return el;
+		}
+		return null;
+	};
+	return days.map((day) => {
+		const items = [];
+		const groups = day.querySelectorAll('.planner-grouping, [class*="Grouping-styles__root"]');
+		const roots = groups.length > 0 ? Array.from(groups) : [day];
+		for (const group of roots) {
+			const course = text(first(group, ['[class*="Grouping-styles__title"]', '.planner-grouping-title', 'a[href*="/courses/"]']));
+			for (const item of group.querySelectorAll('.planner-item, [class*="PlannerItem-styles__root"]')) {
+				const link = first(item, ['[class*="PlannerItem-styles__title"] a', 'a[href]']);
+				const checkbox = item.querySelector('input[type="checkbox"]');
+				items.push({
+					course: course,
+					title: text(link) || text(first(item, ['[class*="PlannerItem-styles__title"]'])),
+					type: text(first(item, ['[class*="PlannerItem-styles__type"]'])),
+					url: link && link.href ? link.href : '',
+					due: text(first(item, ['[class*="PlannerItem-styles__due"]', '[class*="PlannerItem-styles__secondary"]'])),
+					completed: !!(checkbox && checkbox.checked),
+				});
+			}
+		}
+		return { heading: text(first(day, ['h2', 'h3', '[class*="Day-styles__header"]'])), items: items };
+	});
+}`
+
+// extractPlannerDays はページ内の .planner-day から構造化された項目を取り出します
+func extractPlannerDays(page playwright.Page) ([]PlannerDay, error) {
+	raw, err := page.EvalOnSelectorAll(".planner-day", plannerScript)
+	if err != nil {
+		return nil, fmt.Errorf("プランナー要素の解析エラー: %v", err)
+	}
+	// interface{} で返ってくるので一度JSONを経由して変換する
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var days []PlannerDay
+	if err := json.Unmarshal(data, &days); err != nil {
+		return nil, fmt.Errorf("プランナー要素の変換エラー: %v", err)
+	}
+	return days, nil
+}
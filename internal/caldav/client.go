@@ -0,0 +1,189 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// RequestTimeout は1回のリクエストのタイムアウトです
+const RequestTimeout = 30 * time.Second
+
+// Client はカレンダーコレクション（例: https://cloud.example.com/remote.php/dav/calendars/user/klms/）を操作します
+// Radicale・Nextcloud・Baïkal など、一般的なCalDAVサーバーで動作します
+type Client struct {
+	URL  string // コレクションのURL（末尾の / は省略可）
+	User string
+	Pass string
+	HTTP *http.Client
+}
+
+// Resource はコレクション内のカレンダーオブジェクトです
+type Resource struct {
+	Name string // ファイル名（例: klms-xxxx.ics）
+	ETag string
+}
+
+// NewClient は CalDAV クライアントを作成します
+func NewClient(collectionURL, user, pass string) *Client {
+	return &Client{
+		URL:  strings.TrimSuffix(collectionURL, "/") + "/",
+		User: user,
+		Pass: pass,
+		HTTP: &http.Client{Timeout: RequestTimeout},
+	}
+}
+
+// propfindBody はコレクション内のオブジェクトのETagを問い合わせるリクエストです
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:getetag/>
+    <d:resourcetype/>
+  </d:prop>
+</d:propfind>`
+
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ETag         string    `xml:"DAV: getetag"`
+				ResourceType *struct{} `xml:"DAV: resourcetype>collection"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// List はコレクション内のオブジェクトの一覧を返します（PROPFIND Depth: 1）
+func (c *Client) List(ctx context.Context) (map[string]Resource, error) {
+	req, err := c.newRequest(ctx, "PROPFIND", c.URL, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("CalDAV PROPFINDエラー: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("CalDAV PROPFIND失敗: %s", resp.Status)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("CalDAVの応答の解析エラー: %v", err)
+	}
+
+	resources := map[string]Resource{}
+	for _, r := range ms.Responses {
+		name := resourceName(r.Href)
+		if name == "" || !strings.HasSuffix(name, ".ics") {
+			continue // コレクション自身など
+		}
+		res := Resource{Name: name}
+		for _, ps := range r.Propstat {
+			if strings.Contains(ps.Status, " 200 ") && ps.Prop.ResourceType == nil {
+				res.ETag = ps.Prop.ETag
+			}
+		}
+		resources[name] = res
+	}
+	return resources, nil
+}
+
+// Create はオブジェクトを新規作成し、サーバーが返したETagを返します（返さないサーバーもあります）
+// If-None-Match: * を付けるため、同じ名前のオブジェクトが既にあれば上書きせずに失敗します
+func (c *Client) Create(ctx context.Context, name, body string) (string, error) {
+	return c.put(ctx, name, body, "If-None-Match", "*")
+}
+
+// Update はオブジェクトを上書きし、サーバーが返したETagを返します
+// etag を指定すると If-Match を付け、取得してから他で変更・削除されていれば上書きせずに失敗します（412）
+func (c *Client) Update(ctx context.Context, name, body, etag string) (string, error) {
+	return c.put(ctx, name, body, "If-Match", etag)
+}
+
+func (c *Client) put(ctx context.Context, name, body, condition, value string) (string, error) {
+	req, err := c.newRequest(ctx, "PUT", c.URL+url.PathEscape(name), bytes.NewReader([]byte(body)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	if value != "" {
+		req.Header.Set(condition, value)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("CalDAV PUTエラー: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return "", fmt.Errorf("CalDAV PUT失敗（%s）: 他で変更されたため上書きしませんでした（次回の同期で再試行します）", name)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("CalDAV PUT失敗（%s）: %s", name, resp.Status)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// Delete はオブジェクトを削除します（既に存在しない場合も成功とします）
+func (c *Client) Delete(ctx context.Context, name string) error {
+	req, err := c.newRequest(ctx, "DELETE", c.URL+url.PathEscape(name), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("CalDAV DELETEエラー: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("CalDAV DELETE失敗（%s）: %s", name, resp.Status)
+	}
+	return nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.User != "" || c.Pass != "" {
+		req.SetBasicAuth(c.User, c.Pass)
+	}
+	return req, nil
+}
+
+// resourceName は href（パスまたはURL）からファイル名を取り出します
+func resourceName(href string) string {
+	if u, err := url.Parse(href); err == nil {
+		href = u.Path
+	}
+	if strings.HasSuffix(href, "/") {
+		return ""
+	}
+	name := path.Base(href)
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
@@ -0,0 +1,181 @@
+package caldav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer はメモリ上にオブジェクトを保存する最小限のCalDAVサーバーです
+// PROPFIND（Depth: 1）・条件付きPUT（If-Match / If-None-Match）・DELETE に対応します
+type fakeServer struct {
+	mu       sync.Mutex
+	objects  map[string]fakeObject
+	version  int
+	requests []string // "METHOD 名前 条件" の記録
+}
+
+type fakeObject struct {
+	body string
+	etag string
+}
+
+const fakeCollection = "/dav/calendars/user/klms/"
+
+func newFakeServer(t *testing.T) (*fakeServer, *Client) {
+	t.Helper()
+	f := &fakeServer{objects: map[string]fakeObject{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	c := NewClient(srv.URL+fakeCollection, "user", "pass")
+	return f, c
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, fakeCollection)
+	f.requests = append(f.requests, strings.TrimSpace(fmt.Sprintf("%s %s %s%s", r.Method, name, r.Header.Get("If-Match"), r.Header.Get("If-None-Match"))))
+
+	obj, exists := f.objects[name]
+	switch r.Method {
+	case "PROPFIND":
+		if r.Header.Get("Depth") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+		fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, fakeCollection)
+		for n, o := range f.objects {
+			fmt.Fprintf(w, `<d:response><d:href>%s%s</d:href><d:propstat><d:prop><d:getetag>%s</d:getetag><d:resourcetype/></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, fakeCollection, n, o.etag)
+		}
+		fmt.Fprint(w, `</d:multistatus>`)
+	case "PUT":
+		if (r.Header.Get("If-None-Match") == "*" && exists) ||
+			(r.Header.Get("If-Match") != "" && (!exists || r.Header.Get("If-Match") != obj.etag)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.version++
+		f.objects[name] = fakeObject{body: string(body), etag: fmt.Sprintf(`"v%d"`, f.version)}
+		w.Header().Set("ETag", f.objects[name].etag)
+		if exists {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "DELETE":
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// edit はサーバー側（ほかのカレンダーアプリ）での編集を再現します
+func (f *fakeServer) edit(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version++
+	f.objects[name] = fakeObject{body: f.objects[name].body + "edited", etag: fmt.Sprintf(`"v%d"`, f.version)}
+}
+
+func (f *fakeServer) takeRequests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.requests
+	f.requests = nil
+	return r
+}
+
+func TestClientCreateUpdateDelete(t *testing.T) {
+	f, c := newFakeServer(t)
+	ctx := context.Background()
+
+	etag, err := c.Create(ctx, "klms-a.ics", "BEGIN:VCALENDAR")
+	if err != nil || etag != `"v1"` {
+		t.Fatalf("Create = %q, %v", etag, err)
+	}
+	if _, err := c.Create(ctx, "klms-a.ics", "BEGIN:VCALENDAR"); err == nil {
+		t.Error("Create overwrote an existing object")
+	}
+
+	resources, err := c.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 1 || resources["klms-a.ics"].ETag != `"v1"` {
+		t.Fatalf("List = %+v", resources)
+	}
+
+	etag, err = c.Update(ctx, "klms-a.ics", "BEGIN:VCALENDAR\nv2", `"v1"`)
+	if err != nil || etag != `"v2"` {
+		t.Fatalf("Update = %q, %v", etag, err)
+	}
+	// 古いETagでは上書きしない
+	if _, err := c.Update(ctx, "klms-a.ics", "stale", `"v1"`); err == nil {
+		t.Error("Update with a stale ETag succeeded")
+	}
+	if f.objects["klms-a.ics"].body != "BEGIN:VCALENDAR\nv2" {
+		t.Errorf("body = %q", f.objects["klms-a.ics"].body)
+	}
+
+	if err := c.Delete(ctx, "klms-a.ics"); err != nil {
+		t.Fatal(err)
+	}
+	// 既に削除されているオブジェクトの削除も成功とする
+	if err := c.Delete(ctx, "klms-a.ics"); err != nil {
+		t.Fatalf("Delete of a missing object: %v", err)
+	}
+	if len(f.objects) != 0 {
+		t.Errorf("objects = %v", f.objects)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "", "")
+	ctx := context.Background()
+
+	if _, err := c.List(ctx); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("List err = %v", err)
+	}
+	if _, err := c.Create(ctx, "klms-a.ics", ""); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Create err = %v", err)
+	}
+	if err := c.Delete(ctx, "klms-a.ics"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Delete err = %v", err)
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	tests := map[string]string{
+		"/dav/calendars/user/klms/klms-abc.ics":        "klms-abc.ics",
+		"https://cloud.example.com/dav/klms/a%20b.ics": "a b.ics",
+		"/dav/calendars/user/klms/":                    "",
+	}
+	for href, want := range tests {
+		if got := resourceName(href); got != want {
+			t.Errorf("resourceName(%q) = %q, want %q", href, got, want)
+		}
+	}
+}
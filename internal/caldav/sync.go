@@ -0,0 +1,160 @@
+package caldav
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"klms-go/internal/diff"
+	"klms-go/internal/ics"
+	"klms-go/internal/storage"
+)
+
+const (
+	// ResourcePrefix はこのプログラムが作成したオブジェクトのファイル名の先頭です
+	// これで始まらないオブジェクトには触れません
+	ResourcePrefix = "klms-"
+
+	// ResyncInterval は課題に変化がなくてもサーバーと照合し直す間隔です
+	ResyncInterval = time.Hour
+)
+
+// State は登録済みのオブジェクト（ファイル名 → 内容のハッシュとETag）です
+type State struct {
+	LastSync  time.Time                `json:"last_sync"`
+	Resources map[string]ResourceState `json:"resources"`
+}
+
+// ResourceState は登録済みのオブジェクト1件の記録です
+type ResourceState struct {
+	Hash string `json:"hash"`
+	ETag string `json:"etag,omitempty"`
+}
+
+// SyncResult は同期の結果です
+type SyncResult struct {
+	Created int
+	Updated int
+	Deleted int
+}
+
+func (r SyncResult) String() string {
+	return fmt.Sprintf("追加 %d 件・更新 %d 件・削除 %d 件", r.Created, r.Updated, r.Deleted)
+}
+
+// LoadState は記録を読み込みます（なければ空）
+func LoadState() *State {
+	s := &State{Resources: map[string]ResourceState{}}
+	if _, err := storage.Load(storage.BucketCalDAV, storage.KeyCalDAV, s); err != nil {
+		log.Printf("⚠️ CalDAVの記録の読み込みエラー: %v", err)
+	}
+	if s.Resources == nil {
+		s.Resources = map[string]ResourceState{}
+	}
+	return s
+}
+
+// Save は記録を保存します
+func (s *State) Save() error {
+	return storage.Save(storage.BucketCalDAV, storage.KeyCalDAV, s)
+}
+
+// NeedsSync は課題一覧が前回の同期より後に更新されたか、照合の間隔を過ぎたかを返します
+func (s *State) NeedsSync(snapshotModTime, now time.Time) bool {
+	return snapshotModTime.After(s.LastSync) || now.Sub(s.LastSync) >= ResyncInterval
+}
+
+// ResourceNameFor は課題のオブジェクトのファイル名を返します（UIDと対応）
+func ResourceNameFor(key string) string {
+	return ResourcePrefix + strings.TrimSuffix(ics.UID(key), "@klms-auto") + ".ics"
+}
+
+// Sync はサーバー上の予定を課題一覧に合わせます
+// - 未完了の課題は作成し、内容が変わったか、サーバー側で編集されていれば上書きします
+// - 一覧にない（削除・完了した）課題の予定は削除します
+func (c *Client) Sync(ctx context.Context, items []diff.Item, opts ics.Options, state *State) (SyncResult, error) {
+	var result SyncResult
+	remote, err := c.List(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	// 内容のハッシュは DTSTAMP の影響を受けないよう固定の時刻で計算する
+	hashOpts := opts
+	hashOpts.Stamp = time.Unix(0, 0)
+
+	desired := map[string]bool{}
+	var errs []string
+	for _, item := range items {
+		if item.Completed {
+			continue
+		}
+		name := ResourceNameFor(item.Key)
+		// 期限を解釈できない課題も一覧にはあるので、登録済みの予定は削除しない
+		desired[name] = true
+		canonical, ok := ics.GenerateObject(item, hashOpts)
+		if !ok {
+			log.Printf("⚠️ CalDAV: %s / %s の期限（%q）を解釈できないため予定を更新しません", item.Course, item.Title, item.Deadline)
+			continue
+		}
+		sum := sha256.Sum256([]byte(canonical))
+		hash := hex.EncodeToString(sum[:])
+
+		prev, known := state.Resources[name]
+		res, exists := remote[name]
+		if exists && known && prev.Hash == hash {
+			if prev.ETag == "" || prev.ETag == res.ETag {
+				// 変更なし（ETagを返さないサーバーではここで記録する）
+				state.Resources[name] = ResourceState{Hash: hash, ETag: res.ETag}
+				continue
+			}
+			log.Printf("✏️ CalDAV: %s はサーバー側で編集されていたため上書きします", name)
+		}
+
+		// 照合した時点のETagを条件にして、その後に他で変更された予定を上書きしないようにする
+		body, _ := ics.GenerateObject(item, opts)
+		var etag string
+		if exists {
+			etag, err = c.Update(ctx, name, body, res.ETag)
+		} else {
+			etag, err = c.Create(ctx, name, body)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		state.Resources[name] = ResourceState{Hash: hash, ETag: etag}
+		if exists {
+			result.Updated++
+		} else {
+			result.Created++
+		}
+	}
+
+	// このプログラムが作成した予定のうち、不要になったものを削除する
+	for name := range remote {
+		if strings.HasPrefix(name, ResourcePrefix) && !desired[name] {
+			if err := c.Delete(ctx, name); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			delete(state.Resources, name)
+			result.Deleted++
+		}
+	}
+	for name := range state.Resources {
+		if _, exists := remote[name]; !exists && !desired[name] {
+			delete(state.Resources, name)
+		}
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("CalDAV同期で %d 件のエラー: %s", len(errs), strings.Join(errs, "; "))
+	}
+	state.LastSync = time.Now()
+	return result, nil
+}
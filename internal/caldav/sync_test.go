@@ -0,0 +1,134 @@
+package caldav
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"klms-go/internal/diff"
+	"klms-go/internal/ics"
+	"klms-go/internal/ocr"
+)
+
+func syncItem(key, title, deadline string) diff.Item {
+	return diff.Item{Key: key, Assignment: ocr.Assignment{Course: "統計学基礎", Title: title, Deadline: deadline}}
+}
+
+func sorted(s []string) []string {
+	sort.Strings(s)
+	return s
+}
+
+func TestSync(t *testing.T) {
+	f, c := newFakeServer(t)
+	ctx := context.Background()
+	state := &State{Resources: map[string]ResourceState{}}
+	a, b := ResourceNameFor("a"), ResourceNameFor("b")
+
+	// 1. 作成（If-None-Match: *）
+	items := []diff.Item{syncItem("a", "課題1", "2026-01-13 23:59"), syncItem("b", "課題2", "2026-01-20 23:59")}
+	result, err := c.Sync(ctx, items, ics.Options{}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (SyncResult{Created: 2}) {
+		t.Fatalf("result = %v", result)
+	}
+	if got := sorted(f.takeRequests()); !reflect.DeepEqual(got, sorted([]string{"PROPFIND", "PUT " + a + " *", "PUT " + b + " *"})) {
+		t.Fatalf("requests = %v", got)
+	}
+	if !strings.Contains(f.objects[a].body, "SUMMARY:統計学基礎: 課題1") || state.Resources[a].ETag != f.objects[a].etag {
+		t.Fatalf("object = %+v, state = %+v", f.objects[a], state.Resources[a])
+	}
+
+	// 2. 変更がなければ何も送らない
+	if result, err := c.Sync(ctx, items, ics.Options{}, state); err != nil || result != (SyncResult{}) {
+		t.Fatalf("result = %v, %v", result, err)
+	}
+	if got := f.takeRequests(); !reflect.DeepEqual(got, []string{"PROPFIND"}) {
+		t.Fatalf("requests = %v", got)
+	}
+
+	// 3. 期限の変更は照合時のETagを条件に上書きする
+	etag := f.objects[a].etag
+	items[0].Deadline = "2026-01-14 23:59"
+	items[0].Sequence = 1
+	if result, err := c.Sync(ctx, items, ics.Options{}, state); err != nil || result != (SyncResult{Updated: 1}) {
+		t.Fatalf("result = %v, %v", result, err)
+	}
+	if got := f.takeRequests(); !reflect.DeepEqual(got, []string{"PROPFIND", "PUT " + a + " " + etag}) {
+		t.Fatalf("requests = %v", got)
+	}
+	if !strings.Contains(f.objects[a].body, "20260114T") || state.Resources[a].ETag != f.objects[a].etag {
+		t.Fatalf("object was not updated: %q", f.objects[a].body)
+	}
+
+	// 4. サーバー側で編集された予定は、新しいETagで上書きし直す
+	f.edit(b)
+	etag = f.objects[b].etag
+	if result, err := c.Sync(ctx, items, ics.Options{}, state); err != nil || result != (SyncResult{Updated: 1}) {
+		t.Fatalf("result = %v, %v", result, err)
+	}
+	if got := f.takeRequests(); !reflect.DeepEqual(got, []string{"PROPFIND", "PUT " + b + " " + etag}) {
+		t.Fatalf("requests = %v", got)
+	}
+
+	// 5. 一覧から消えた課題と完了した課題の予定を削除する（自分で作っていない予定には触れない）
+	f.objects["personal.ics"] = fakeObject{body: "mine", etag: `"p"`}
+	items[1].Completed = true
+	if result, err := c.Sync(ctx, items[1:], ics.Options{}, state); err != nil || result != (SyncResult{Deleted: 2}) {
+		t.Fatalf("result = %v, %v", result, err)
+	}
+	if len(f.objects) != 1 || len(state.Resources) != 0 {
+		t.Fatalf("objects = %v, state = %v", f.objects, state.Resources)
+	}
+}
+
+func TestSyncRecreatesDeletedObject(t *testing.T) {
+	f, c := newFakeServer(t)
+	ctx := context.Background()
+	state := &State{Resources: map[string]ResourceState{}}
+	items := []diff.Item{syncItem("a", "課題1", "2026-01-13 23:59")}
+	if _, err := c.Sync(ctx, items, ics.Options{}, state); err != nil {
+		t.Fatal(err)
+	}
+
+	// サーバー側で削除された予定は作り直す
+	delete(f.objects, ResourceNameFor("a"))
+	f.takeRequests()
+	if result, err := c.Sync(ctx, items, ics.Options{}, state); err != nil || result != (SyncResult{Created: 1}) {
+		t.Fatalf("result = %v, %v", result, err)
+	}
+	if got := f.takeRequests(); !reflect.DeepEqual(got, []string{"PROPFIND", "PUT " + ResourceNameFor("a") + " *"}) {
+		t.Fatalf("requests = %v", got)
+	}
+}
+
+func TestSyncKeepsObjectWhenDeadlineIsUnparsable(t *testing.T) {
+	f, c := newFakeServer(t)
+	ctx := context.Background()
+	state := &State{Resources: map[string]ResourceState{}}
+	items := []diff.Item{syncItem("a", "課題1", "2026-01-13 23:59")}
+	if _, err := c.Sync(ctx, items, ics.Options{}, state); err != nil {
+		t.Fatal(err)
+	}
+	body := f.objects[ResourceNameFor("a")].body
+
+	// 期限を一時的に解釈できなくても、一覧にある課題の予定は削除も更新もしない
+	items[0].Deadline = "期限未定"
+	f.takeRequests()
+	if result, err := c.Sync(ctx, items, ics.Options{}, state); err != nil || result != (SyncResult{}) {
+		t.Fatalf("result = %v, %v", result, err)
+	}
+	if got := f.takeRequests(); !reflect.DeepEqual(got, []string{"PROPFIND"}) {
+		t.Fatalf("requests = %v", got)
+	}
+	if obj, ok := f.objects[ResourceNameFor("a")]; !ok || obj.body != body {
+		t.Fatalf("予定が変更されました: %+v", obj)
+	}
+	if _, ok := state.Resources[ResourceNameFor("a")]; !ok {
+		t.Fatal("登録済みの記録が消えました")
+	}
+}
@@ -0,0 +1,187 @@
+package canvas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://lms.keio.jp"
+	RequestTimeout = 30 * time.Second // 1リクエストあたりのタイムアウト
+	PerPage        = 100              // ページングの1ページあたり件数
+)
+
+// Canvasはセッション認証のJSONレスポンスにこの接頭辞を付けます
+const jsonHijackPrefix = "while(1);"
+
+var nextLinkPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// Client はCanvas REST APIのクライアントです
+type Client struct {
+	BaseURL string
+	Token   string         // 個人アクセストークン（空ならCookie認証）
+	Cookies []*http.Cookie // Playwrightのセッションから引き継いだCookie
+	HTTP    *http.Client
+}
+
+// playwrightState は Playwright の StorageState ファイル（data/state.json）の形式です
+type playwrightState struct {
+	Cookies []struct {
+		Name     string  `json:"name"`
+		Value    string  `json:"value"`
+		Domain   string  `json:"domain"`
+		Path     string  `json:"path"`
+		Expires  float64 `json:"expires"`
+		Secure   bool    `json:"secure"`
+		HTTPOnly bool    `json:"httpOnly"`
+	} `json:"cookies"`
+}
+
+// NewClient はクライアントを作成します
+// token が空の場合は stateFile（Playwrightのセッション）のCookieで認証します
+func NewClient(baseURL, token, stateFile string) (*Client, error) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	c := &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: RequestTimeout},
+	}
+	if token != "" {
+		return c, nil
+	}
+
+	cookies, err := loadSessionCookies(stateFile, c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(cookies) == 0 {
+		return nil, fmt.Errorf("有効なセッションCookieがありません（%s）", stateFile)
+	}
+	c.Cookies = cookies
+	return c, nil
+}
+
+// loadSessionCookies は state.json から baseURL のホストに送るべきCookieを取り出します
+func loadSessionCookies(stateFile, baseURL string) ([]*http.Cookie, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("CanvasのURLが不正です: %v", err)
+	}
+	data, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		return nil, fmt.Errorf("セッションファイル読み込みエラー: %v", err)
+	}
+	var state playwrightState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("セッションファイル解析エラー: %v", err)
+	}
+
+	host := u.Hostname()
+	now := float64(time.Now().Unix())
+	var cookies []*http.Cookie
+	for _, sc := range state.Cookies {
+		domain := strings.TrimPrefix(sc.Domain, ".")
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			continue
+		}
+		// expires が -1 のものはセッションCookie
+		if sc.Expires > 0 && sc.Expires < now {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{Name: sc.Name, Value: sc.Value})
+	}
+	return cookies, nil
+}
+
+// getAll は path をGETし、Linkヘッダをたどって全ページを appendPage に渡します
+// 次のページがCanvasと別のホストを指している場合は、トークンやCookieを送らずにエラーにします
+func (c *Client) getAll(ctx context.Context, path string, appendPage func(raw []byte) error) error {
+	next := c.BaseURL + path
+	for next != "" {
+		body, link, err := c.get(ctx, next)
+		if err != nil {
+			return err
+		}
+		if err := appendPage(body); err != nil {
+			return fmt.Errorf("レスポンス解析エラー（%s）: %v", path, err)
+		}
+		m := nextLinkPattern.FindStringSubmatch(link)
+		if m == nil {
+			break
+		}
+		if next, err = c.nextPageURL(next, m[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextPageURL はLinkヘッダの次のページのURLを current を基準に解決し、BaseURL と同じスキーム・ホストかを確認します
+func (c *Client) nextPageURL(current, link string) (string, error) {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("CanvasのURLが不正です: %v", err)
+	}
+	cur, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("次のページのURLが不正です: %q", link)
+	}
+	u := cur.ResolveReference(ref)
+	if !strings.EqualFold(u.Scheme, base.Scheme) || !strings.EqualFold(u.Host, base.Host) {
+		return "", fmt.Errorf("次のページのURLがCanvas（%s）と別のホストを指しているため取得しません: %s", base.Host, u.Redacted())
+	}
+	return u.String(), nil
+}
+
+func (c *Client) get(ctx context.Context, rawURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else {
+		for _, cookie := range c.Cookies {
+			req.AddCookie(cookie)
+		}
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, "", fmt.Errorf("Canvas API認証エラー（セッション切れの可能性）: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("Canvas APIエラー: %s", resp.Status)
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		// ログイン画面にリダイレクトされた場合
+		return nil, "", fmt.Errorf("Canvas APIがHTMLを返しました（未ログインの可能性）")
+	}
+
+	body = []byte(strings.TrimPrefix(string(body), jsonHijackPrefix))
+	return body, resp.Header.Get("Link"), nil
+}
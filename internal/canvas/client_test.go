@@ -0,0 +1,238 @@
+package canvas
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCanvas はパスごとに決まったレスポンスを返すCanvas APIです
+type fakeCanvas struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	routes   map[string]func(w http.ResponseWriter, r *http.Request)
+}
+
+func newFakeCanvas(t *testing.T) *fakeCanvas {
+	t.Helper()
+	f := &fakeCanvas{routes: map[string]func(w http.ResponseWriter, r *http.Request){}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r)
+		route := f.routes[r.URL.Path]
+		f.mu.Unlock()
+		if route == nil {
+			http.NotFound(w, r)
+			return
+		}
+		route(w, r)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// jsonRoute は body をJSONとして返すハンドラです（link があれば Link ヘッダを付けます）
+func jsonRoute(body, link string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if link != "" {
+			w.Header().Set("Link", link)
+		}
+		fmt.Fprint(w, body)
+	}
+}
+
+func TestGetAllFollowsPagination(t *testing.T) {
+	f := newFakeCanvas(t)
+	f.routes["/api/v1/courses"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "2" {
+			// セッション認証のレスポンスには while(1); が付く
+			fmt.Fprint(w, `while(1);[{"id":2,"name":"経済学"}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/api/v1/courses?page=2>; rel="next", <%s/api/v1/courses?page=1>; rel="first"`, f.URL, f.URL))
+		fmt.Fprint(w, `[{"id":1,"name":"情報処理"}]`)
+	}
+
+	c, err := NewClient(f.URL, "secret-token", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := c.fetchCourseNames(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int64]string{1: "情報処理", 2: "経済学"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("コース名: %v", names)
+	}
+	if len(f.requests) != 2 {
+		t.Fatalf("リクエスト数: %d", len(f.requests))
+	}
+	for _, r := range f.requests {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret-token" {
+			t.Errorf("Authorization ヘッダー: %q", got)
+		}
+	}
+}
+
+func TestGetAllRejectsNextPageOnAnotherHost(t *testing.T) {
+	other := newFakeCanvas(t)
+	other.routes["/steal"] = jsonRoute(`[]`, "")
+
+	f := newFakeCanvas(t)
+	f.routes["/api/v1/courses"] = jsonRoute(`[{"id":1,"name":"情報処理"}]`, fmt.Sprintf(`<%s/steal>; rel="next"`, other.URL))
+
+	c, err := NewClient(f.URL, "secret-token", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.fetchCourseNames(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "別のホスト") {
+		t.Fatalf("別のホストへのページングがエラーになりません: %v", err)
+	}
+	if len(other.requests) != 0 {
+		t.Errorf("別のホストにリクエストを送りました: %d 件", len(other.requests))
+	}
+}
+
+func TestGetAllResolvesRelativeNextPage(t *testing.T) {
+	f := newFakeCanvas(t)
+	f.routes["/api/v1/courses"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"id":2,"name":"経済学"}]`)
+			return
+		}
+		w.Header().Set("Link", `</api/v1/courses?page=2>; rel="next"`)
+		fmt.Fprint(w, `[{"id":1,"name":"情報処理"}]`)
+	}
+	c, _ := NewClient(f.URL, "secret-token", "")
+	names, err := c.fetchCourseNames(context.Background())
+	if err != nil || len(names) != 2 {
+		t.Fatalf("相対URLの次のページを取得できません: %v, %v", names, err)
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	f := newFakeCanvas(t)
+	f.routes["/api/v1/courses"] = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+	f.routes["/api/v1/users/self/todo"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html>login</html>")
+	}
+	c, _ := NewClient(f.URL, "secret-token", "")
+
+	if _, err := c.fetchCourseNames(context.Background()); err == nil || !strings.Contains(err.Error(), "認証エラー") {
+		t.Errorf("401 が認証エラーになりません: %v", err)
+	}
+	if _, err := c.fetchTodo(context.Background()); err == nil || !strings.Contains(err.Error(), "HTML") {
+		t.Errorf("ログイン画面がエラーになりません: %v", err)
+	}
+}
+
+func TestFetchAssignmentsFromPlanner(t *testing.T) {
+	f := newFakeCanvas(t)
+	f.routes["/api/v1/planner/items"] = jsonRoute(`[
+		{"plannable_id": 11, "plannable_type": "assignment", "course_id": 1, "context_name": "情報処理",
+		 "html_url": "/courses/1/assignments/11", "submissions": {"submitted": true},
+		 "plannable": {"title": "第8回 演習", "due_at": "2026-12-03T14:59:00Z", "points_possible": 10}},
+		{"plannable_id": 12, "plannable_type": "quiz", "course_id": 2, "context_name": "経済学",
+		 "html_url": "/courses/2/quizzes/12", "submissions": false,
+		 "plannable": {"title": "確認テスト", "due_at": "2026-12-02T08:00:00Z"}},
+		{"plannable_id": 13, "plannable_type": "announcement", "context_name": "経済学",
+		 "plannable": {"title": "お知らせ"}, "plannable_date": "2026-12-01T00:00:00Z"},
+		{"plannable_id": 14, "plannable_type": "assignment", "context_name": "経済学",
+		 "plannable": {"title": "非表示", "due_at": "2026-12-04T00:00:00Z"}, "planner_override": {"dismissed": true}}
+	]`, "")
+	c, _ := NewClient(f.URL, "secret-token", "")
+
+	got, err := c.FetchAssignments(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("課題数: %d: %+v", len(got), got)
+	}
+	quiz, assignment := got[0], got[1]
+	if quiz.Title != "確認テスト" || quiz.Deadline != "2026-12-02 17:00" || quiz.Completed || quiz.SourceID != "canvas:quiz:12" {
+		t.Errorf("小テスト: %+v", quiz)
+	}
+	if assignment.Deadline != "2026-12-03 23:59" || !assignment.Completed || assignment.URL != f.URL+"/courses/1/assignments/11" || assignment.CourseID != "1" {
+		t.Errorf("課題: %+v", assignment)
+	}
+}
+
+func TestFetchAssignmentsFallsBackToTodo(t *testing.T) {
+	f := newFakeCanvas(t)
+	f.routes["/api/v1/planner/items"] = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "disabled", http.StatusForbidden)
+	}
+	f.routes["/api/v1/users/self/todo"] = jsonRoute(`while(1);[
+		{"type": "submitting", "course_id": 1, "assignment": {"id": 21, "name": "レポート", "due_at": "2026-12-05T14:59:00Z", "html_url": "https://lms.example/courses/1/assignments/21"}},
+		{"type": "submitting", "course_id": 3, "html_url": "/courses/3/quizzes/22", "quiz": {"id": 22, "title": "小テスト", "due_at": "2026-12-06T03:00:00Z"}},
+		{"type": "grading", "course_id": 1}
+	]`, "")
+	f.routes["/api/v1/courses"] = jsonRoute(`[{"id":1,"name":"情報処理"}]`, "")
+	c, _ := NewClient(f.URL, "secret-token", "")
+
+	got, err := c.FetchAssignments(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("課題数: %d: %+v", len(got), got)
+	}
+	if got[0].Course != "情報処理" || got[0].Deadline != "2026-12-05 23:59" || got[0].SourceID != "canvas:assignment:21" || got[0].URL != "https://lms.example/courses/1/assignments/21" {
+		t.Errorf("ToDoの課題: %+v", got[0])
+	}
+	// コース一覧にないコースはIDで表示する
+	if got[1].Course != "コース 3" || got[1].Type != "quiz" || got[1].URL != f.URL+"/courses/3/quizzes/22" {
+		t.Errorf("ToDoの小テスト: %+v", got[1])
+	}
+}
+
+func TestFetchAssignmentsReportsBothErrors(t *testing.T) {
+	f := newFakeCanvas(t)
+	c, _ := NewClient(f.URL, "secret-token", "")
+	_, err := c.FetchAssignments(context.Background())
+	if err == nil || strings.Count(err.Error(), "404") != 2 {
+		t.Errorf("両方のAPIのエラーが含まれていません: %v", err)
+	}
+}
+
+func TestNewClientUsesSessionCookies(t *testing.T) {
+	f := newFakeCanvas(t)
+	f.routes["/api/v1/courses"] = jsonRoute(`[]`, "")
+	state := filepath.Join(t.TempDir(), "state.json")
+	ioutil.WriteFile(state, []byte(`{"cookies": [
+		{"name": "canvas_session", "value": "abc", "domain": "127.0.0.1", "expires": -1},
+		{"name": "other", "value": "x", "domain": ".example.com", "expires": -1},
+		{"name": "expired", "value": "y", "domain": "127.0.0.1", "expires": 1}
+	]}`), 0644)
+
+	c, err := NewClient(f.URL, "", state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.fetchCourseNames(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	r := f.requests[0]
+	if got := r.Header.Get("Cookie"); got != "canvas_session=abc" {
+		t.Errorf("Cookie ヘッダー: %q", got)
+	}
+	if r.Header.Get("Authorization") != "" {
+		t.Error("Cookie認証なのに Authorization ヘッダーがあります")
+	}
+}
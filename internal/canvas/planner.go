@@ -0,0 +1,251 @@
+package canvas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"klms-go/internal/ocr"
+)
+
+// 何日先までの課題を取得するか
+const (
+	LookBackDays  = 1
+	LookAheadDays = 60
+)
+
+// PlannerItem は /api/v1/planner/items の1件です
+type PlannerItem struct {
+	PlannableID   int64           `json:"plannable_id"`
+	PlannableType string          `json:"plannable_type"`
+	PlannableDate *time.Time      `json:"plannable_date"`
+	CourseID      int64           `json:"course_id"`
+	ContextName   string          `json:"context_name"`
+	HTMLURL       string          `json:"html_url"`
+	Submissions   json.RawMessage `json:"submissions"` // false またはオブジェクト
+	Plannable     struct {
+		Title          string     `json:"title"`
+		DueAt          *time.Time `json:"due_at"`
+		TodoAt         *time.Time `json:"todo_date"`
+		PointsPossible float64    `json:"points_possible"`
+	} `json:"plannable"`
+	PlannerOverride *struct {
+		MarkedComplete bool `json:"marked_complete"`
+		Dismissed      bool `json:"dismissed"`
+	} `json:"planner_override"`
+}
+
+// TodoItem は /api/v1/users/self/todo の1件です
+type TodoItem struct {
+	Type       string `json:"type"`
+	CourseID   int64  `json:"course_id"`
+	HTMLURL    string `json:"html_url"`
+	Assignment *struct {
+		ID       int64      `json:"id"`
+		Name     string     `json:"name"`
+		DueAt    *time.Time `json:"due_at"`
+		HTMLURL  string     `json:"html_url"`
+		CourseID int64      `json:"course_id"`
+	} `json:"assignment"`
+	Quiz *struct {
+		ID      int64      `json:"id"`
+		Title   string     `json:"title"`
+		DueAt   *time.Time `json:"due_at"`
+		HTMLURL string     `json:"html_url"`
+	} `json:"quiz"`
+}
+
+type course struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type submissionState struct {
+	Submitted bool `json:"submitted"`
+	Excused   bool `json:"excused"`
+	Graded    bool `json:"graded"`
+}
+
+// FetchAssignments はプランナーAPIから課題一覧を取得します
+// プランナーAPIが使えない場合は ToDo API にフォールバックします
+func (c *Client) FetchAssignments(ctx context.Context) ([]ocr.Assignment, error) {
+	assignments, err := c.fetchPlanner(ctx)
+	if err == nil {
+		return assignments, nil
+	}
+	log.Printf("⚠️ プランナーAPI取得エラー（ToDo APIで再試行します）: %v", err)
+
+	assignments, todoErr := c.fetchTodo(ctx)
+	if todoErr != nil {
+		return nil, fmt.Errorf("Canvas APIから課題を取得できませんでした: %v / %v", err, todoErr)
+	}
+	return assignments, nil
+}
+
+func (c *Client) fetchPlanner(ctx context.Context) ([]ocr.Assignment, error) {
+	now := time.Now().In(ocr.JST)
+	q := url.Values{}
+	q.Set("start_date", now.AddDate(0, 0, -LookBackDays).Format("2006-01-02"))
+	q.Set("end_date", now.AddDate(0, 0, LookAheadDays).Format("2006-01-02"))
+	q.Set("per_page", strconv.Itoa(PerPage))
+
+	var items []PlannerItem
+	err := c.getAll(ctx, "/api/v1/planner/items?"+q.Encode(), func(raw []byte) error {
+		var page []PlannerItem
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return err
+		}
+		items = append(items, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var assignments []ocr.Assignment
+	for _, item := range items {
+		due := item.Plannable.DueAt
+		if due == nil {
+			due = item.Plannable.TodoAt
+		}
+		if due == nil {
+			due = item.PlannableDate
+		}
+		// 期限のない項目（お知らせなど）は対象外
+		if due == nil || item.PlannableType == "announcement" {
+			continue
+		}
+		if item.PlannerOverride != nil && item.PlannerOverride.Dismissed {
+			continue
+		}
+
+		completed := false
+		var sub submissionState
+		if json.Unmarshal(item.Submissions, &sub) == nil {
+			completed = sub.Submitted || sub.Excused || sub.Graded
+		}
+		if item.PlannerOverride != nil && item.PlannerOverride.MarkedComplete {
+			completed = true
+		}
+
+		assignments = append(assignments, ocr.Assignment{
+			Course:    item.ContextName,
+			Title:     item.Plannable.Title,
+			Deadline:  due.In(ocr.JST).Format(ocr.DeadlineLayout),
+			CourseID:  formatID(item.CourseID),
+			URL:       c.absoluteURL(item.HTMLURL),
+			Type:      item.PlannableType,
+			SourceID:  fmt.Sprintf("canvas:%s:%d", item.PlannableType, item.PlannableID),
+			Completed: completed,
+			Points:    item.Plannable.PointsPossible,
+		})
+	}
+	sortByDeadline(assignments)
+	return assignments, nil
+}
+
+func (c *Client) fetchTodo(ctx context.Context) ([]ocr.Assignment, error) {
+	var items []TodoItem
+	err := c.getAll(ctx, "/api/v1/users/self/todo?per_page="+strconv.Itoa(PerPage), func(raw []byte) error {
+		var page []TodoItem
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return err
+		}
+		items = append(items, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// ToDo APIはコース名を返さないので別途取得する
+	courseNames, err := c.fetchCourseNames(ctx)
+	if err != nil {
+		log.Printf("⚠️ コース一覧の取得に失敗しました（コースIDで表示します）: %v", err)
+	}
+
+	var assignments []ocr.Assignment
+	for _, item := range items {
+		var a ocr.Assignment
+		var due *time.Time
+		switch {
+		case item.Assignment != nil:
+			due = item.Assignment.DueAt
+			a = ocr.Assignment{
+				Title:    item.Assignment.Name,
+				URL:      item.Assignment.HTMLURL,
+				Type:     "assignment",
+				SourceID: fmt.Sprintf("canvas:assignment:%d", item.Assignment.ID),
+			}
+		case item.Quiz != nil:
+			due = item.Quiz.DueAt
+			a = ocr.Assignment{
+				Title:    item.Quiz.Title,
+				URL:      item.Quiz.HTMLURL,
+				Type:     "quiz",
+				SourceID: fmt.Sprintf("canvas:quiz:%d", item.Quiz.ID),
+			}
+		default:
+			continue
+		}
+		if due == nil {
+			continue
+		}
+		if a.URL == "" {
+			a.URL = item.HTMLURL
+		}
+		a.URL = c.absoluteURL(a.URL)
+		a.Deadline = due.In(ocr.JST).Format(ocr.DeadlineLayout)
+		a.CourseID = formatID(item.CourseID)
+		a.Course = courseNames[item.CourseID]
+		if a.Course == "" {
+			a.Course = "コース " + a.CourseID
+		}
+		assignments = append(assignments, a)
+	}
+	sortByDeadline(assignments)
+	return assignments, nil
+}
+
+func (c *Client) fetchCourseNames(ctx context.Context) (map[int64]string, error) {
+	names := map[int64]string{}
+	err := c.getAll(ctx, "/api/v1/courses?enrollment_state=active&per_page="+strconv.Itoa(PerPage), func(raw []byte) error {
+		var page []course
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return err
+		}
+		for _, c := range page {
+			names[c.ID] = c.Name
+		}
+		return nil
+	})
+	return names, err
+}
+
+func (c *Client) absoluteURL(path string) string {
+	if path == "" {
+		return ""
+	}
+	if u, err := url.Parse(path); err == nil && u.IsAbs() {
+		return path
+	}
+	return c.BaseURL + path
+}
+
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+func sortByDeadline(assignments []ocr.Assignment) {
+	sort.SliceStable(assignments, func(i, j int) bool {
+		return assignments[i].Deadline < assignments[j].Deadline
+	})
+}
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
+
+	"klms-go/internal/storage"
 )
 
 // Config はアプリケーションの設定を保持します
@@ -16,6 +23,46 @@ type Config struct {
 	GeminiAPIKey string
 	MaxGeminiPerDay int
 
+	// LINE・Gmailの1日あたりの送信上限と、使用回数をリセットする時刻（日本時間の0時からの分）
+	MaxLinePerDay  int
+	MaxGmailPerDay int
+	QuotaResetAt   int
+
+	// 課題の取得元（先頭から順に試す）
+	AssignmentSources []string
+	SourceFixtureFile string // fixtureソースで読み込むJSONファイル
+
+	// Tesseract（tesseractソース）の設定
+	TesseractPath     string // 実行ファイル（空なら PATH 上の tesseract）
+	TesseractLanguage string // 言語（例: jpn+eng）
+
+	// OpenAI互換API（openaiソース。Ollama・LM Studio・vLLMなど）の設定
+	OpenAIBaseURL string // 例: http://localhost:11434/v1
+	OpenAIModel   string // 画像入力に対応したモデル（例: qwen2.5vl:7b）
+	OpenAIAPIKey  string // 空なら認証ヘッダーを付けない
+
+	// Canvas API設定
+	CanvasBaseURL string // 例: https://lms.keio.jp
+	CanvasToken   string // 個人アクセストークン（空ならログインセッションのCookieを使用）
+
+	// 締切リマインダー（期限の何時間前に通知するか。空なら無効）
+	ReminderOffsets []time.Duration
+
+	// カレンダー（.ics）の設定
+	ICSAlarms        []string      // VALARMのトリガー（例: -P1D, -PT3H）
+	ICSEventStyle    string        // 予定の形（block: 期限までの時間枠, point: 期限ちょうど, allday: 期限日の終日）
+	ICSBlockDuration time.Duration // block の長さ
+	ICSCourseStyles  []CourseStyle // 科目ごとのカテゴリ・色
+
+	// カレンダー配信（購読用のHTTPサーバー）
+	CalendarFeedAddr  string // 待ち受けアドレス（例: 127.0.0.1:8080。空なら無効）
+	CalendarFeedToken string // URLに含める秘密のトークン
+
+	// CalDAV（Nextcloud・Radicaleなどのカレンダーに予定を直接登録）
+	CalDAVURL  string // カレンダーコレクションのURL（空なら無効）
+	CalDAVUser string
+	CalDAVPass string
+
 	// LINE通知設定
 	LineToken  string
 	LineUserID string
@@ -24,11 +71,46 @@ type Config struct {
 	SMTPUser string
 	SMTPPass string
 
+	// Slack・Discord通知設定（Incoming Webhook）
+	SlackWebhookURL   string
+	DiscordWebhookURL string
+
+	// 汎用Webhook（署名付きJSONをPOST）
+	WebhookURL    string
+	WebhookSecret string // HMAC-SHA256署名の鍵（空なら署名しない）
+
+	// 常駐モード（daemon）の設定
+	PollInterval     time.Duration // チェックの間隔
+	PollJitter       time.Duration // 間隔に加えるランダムな揺らぎの最大値
+	ActiveHoursStart int           // チェックする時間帯の開始（0時からの分）
+	ActiveHoursEnd   int           // チェックする時間帯の終了（0時からの分。開始と同じなら終日）
+
+	// 他のプロセスが実行中の場合に終了を待つ最大時間（0なら待たずに終了）
+	RunLockWait time.Duration
+
 	// その他
 	CourseListFile string
 }
 
+// カレンダーの予定の形
+const (
+	EventStyleBlock  = "block"
+	EventStylePoint  = "point"
+	EventStyleAllDay = "allday"
+)
+
+// CourseStyle は科目名に Match を含む課題に付けるカテゴリと色です
+type CourseStyle struct {
+	Match      string   `json:"match"`
+	Categories []string `json:"categories,omitempty"`
+	Color      string   `json:"color,omitempty"` // CSSの色名（例: tomato）
+}
+
+// isoDuration はVALARMのトリガーに使える期間（RFC 5545 の dur-value）です
+var isoDuration = regexp.MustCompile(`^[+-]?P(\d+W|\d+D(T(\d+H)?(\d+M)?(\d+S)?)?|T(\d+H)?(\d+M)?(\d+S)?)$`)
+
 // LoadConfig は環境変数から設定を読み込みます
+// エラーの場合も、エラー通知に使えるよう読み込めた範囲の設定を返します
 func LoadConfig() (*Config, error) {
 	cfg := &Config{
 		KeioUser:       os.Getenv("KEIO_USER"),
@@ -39,19 +121,133 @@ func LoadConfig() (*Config, error) {
 		SMTPUser:       os.Getenv("SMTP_USER"),
 		SMTPPass:       os.Getenv("SMTP_PASS"),
 		CourseListFile: "data/courses.json",
-		MaxGeminiPerDay: 20, // デフォルト値
+		MaxGeminiPerDay: storage.DefaultQuotaConfig.Limits[storage.QuotaGemini], // デフォルト値
+		MaxLinePerDay:   storage.DefaultQuotaConfig.Limits[storage.QuotaLine],
+		MaxGmailPerDay:  storage.DefaultQuotaConfig.Limits[storage.QuotaGmail],
+		AssignmentSources: splitList(getEnvDefault("ASSIGNMENT_SOURCE", "canvas,dom,gemini")),
+		SourceFixtureFile: getEnvDefault("SOURCE_FIXTURE_FILE", "data/fixture-assignments.json"),
+		TesseractPath:     os.Getenv("TESSERACT_PATH"),
+		TesseractLanguage: getEnvDefault("TESSERACT_LANG", "jpn+eng"),
+		OpenAIBaseURL:     getEnvDefault("OPENAI_BASE_URL", "http://localhost:11434/v1"),
+		OpenAIModel:       os.Getenv("OPENAI_MODEL"),
+		OpenAIAPIKey:      os.Getenv("OPENAI_API_KEY"),
+		CanvasBaseURL:  os.Getenv("CANVAS_BASE_URL"),
+		CanvasToken:    os.Getenv("CANVAS_TOKEN"),
+		SlackWebhookURL:   os.Getenv("SLACK_WEBHOOK_URL"),
+		DiscordWebhookURL: os.Getenv("DISCORD_WEBHOOK_URL"),
+		WebhookURL:        os.Getenv("WEBHOOK_URL"),
+		WebhookSecret:     os.Getenv("WEBHOOK_SECRET"),
+		CalDAVURL:         os.Getenv("CALDAV_URL"),
+		CalDAVUser:        os.Getenv("CALDAV_USER"),
+		CalDAVPass:        os.Getenv("CALDAV_PASS"),
+	}
+
+	// 1日あたりの使用上限（例: MAX_GEMINI_PER_DAY=20, MAX_LINE_PER_DAY=10, MAX_GMAIL_PER_DAY=50）
+	for key, limit := range map[string]*int{
+		"MAX_GEMINI_PER_DAY": &cfg.MaxGeminiPerDay,
+		"MAX_LINE_PER_DAY":   &cfg.MaxLinePerDay,
+		"MAX_GMAIL_PER_DAY":  &cfg.MaxGmailPerDay,
+	} {
+		if maxStr := os.Getenv(key); maxStr != "" {
+			max, err := strconv.Atoi(maxStr)
+			if err != nil || max <= 0 {
+				return cfg, fmt.Errorf("%sが不正です（1以上の整数を指定してください）: %q", key, maxStr)
+			}
+			*limit = max
+		}
+	}
+	// 使用回数のリセット時刻（日本時間。例: QUOTA_RESET_TIME=17:00）
+	if v := os.Getenv("QUOTA_RESET_TIME"); v != "" {
+		m, err := parseClock(v)
+		if err != nil {
+			return cfg, fmt.Errorf("QUOTA_RESET_TIMEが不正です: %v", err)
+		}
+		cfg.QuotaResetAt = m
 	}
 
-	// 環境変数からMaxGeminiPerDayを読み込む（オプション）
-	if maxStr := os.Getenv("MAX_GEMINI_PER_DAY"); maxStr != "" {
-		if max, err := strconv.Atoi(maxStr); err == nil && max > 0 {
-			cfg.MaxGeminiPerDay = max
+	// リマインダーのタイミング（例: 72h,24h,3h。"off"で無効）
+	if offsets := getEnvDefault("REMINDER_OFFSETS", "72h,24h,3h"); offsets != "off" {
+		durations, err := parseDurations(offsets)
+		if err != nil {
+			return cfg, fmt.Errorf("REMINDER_OFFSETSが不正です: %v", err)
 		}
+		cfg.ReminderOffsets = durations
+	}
+
+	// カレンダーの設定（例: ICS_ALARMS=-P1D,-PT3H, ICS_EVENT_STYLE=block, ICS_BLOCK_DURATION=1h）
+	if alarms := os.Getenv("ICS_ALARMS"); alarms != "" && alarms != "off" {
+		for _, a := range strings.Split(alarms, ",") {
+			a = strings.ToUpper(strings.TrimSpace(a))
+			if !isoDuration.MatchString(a) || strings.HasSuffix(a, "T") {
+				return cfg, fmt.Errorf("ICS_ALARMSが不正です（-P1D や -PT3H の形式で指定してください）: %q", a)
+			}
+			cfg.ICSAlarms = append(cfg.ICSAlarms, a)
+		}
+	}
+	cfg.ICSEventStyle = strings.ToLower(getEnvDefault("ICS_EVENT_STYLE", EventStyleBlock))
+	switch cfg.ICSEventStyle {
+	case EventStyleBlock, EventStylePoint, EventStyleAllDay:
+	default:
+		return cfg, fmt.Errorf("ICS_EVENT_STYLEが不正です（block, point, allday のいずれか）: %q", cfg.ICSEventStyle)
+	}
+	cfg.ICSBlockDuration = time.Hour
+	if v := os.Getenv("ICS_BLOCK_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("ICS_BLOCK_DURATIONが不正です: %q", v)
+		}
+		cfg.ICSBlockDuration = d
+	}
+	styles, err := loadCourseStyles(getEnvDefault("ICS_COURSE_STYLE_FILE", "data/course-styles.json"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ICSCourseStyles = styles
+
+	// カレンダー配信（例: CALENDAR_FEED_ADDR=127.0.0.1:8080）
+	cfg.CalendarFeedAddr = os.Getenv("CALENDAR_FEED_ADDR")
+	cfg.CalendarFeedToken = os.Getenv("CALENDAR_FEED_TOKEN")
+	if cfg.CalendarFeedAddr != "" && len(cfg.CalendarFeedToken) < 16 {
+		return cfg, fmt.Errorf("CALENDAR_FEED_TOKENは16文字以上で設定してください")
+	}
+
+	// 常駐モードの設定（例: POLL_INTERVAL=5m, POLL_JITTER=30s, ACTIVE_HOURS=8:00-24:00）
+	cfg.PollInterval = 5 * time.Minute
+	cfg.PollJitter = 30 * time.Second
+	if v := os.Getenv("POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return cfg, fmt.Errorf("POLL_INTERVALが不正です（1m以上を指定してください）: %q", v)
+		}
+		cfg.PollInterval = d
+	}
+	if v := os.Getenv("POLL_JITTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("POLL_JITTERが不正です: %q", v)
+		}
+		cfg.PollJitter = d
+	}
+	if v := os.Getenv("ACTIVE_HOURS"); v != "" {
+		start, end, err := parseHours(v)
+		if err != nil {
+			return cfg, fmt.Errorf("ACTIVE_HOURSが不正です: %v", err)
+		}
+		cfg.ActiveHoursStart, cfg.ActiveHoursEnd = start, end
+	}
+
+	// 実行が重なった場合の待ち時間（例: RUN_LOCK_WAIT=2m）
+	if v := os.Getenv("RUN_LOCK_WAIT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("RUN_LOCK_WAITが不正です: %q", v)
+		}
+		cfg.RunLockWait = d
 	}
 
 	// 必須項目のバリデーション
 	if err := cfg.Validate(); err != nil {
-		return nil, err
+		return cfg, err
 	}
 
 	return cfg, nil
@@ -59,17 +255,172 @@ func LoadConfig() (*Config, error) {
 
 // Validate は設定の必須項目をチェックします
 func (c *Config) Validate() error {
-	if c.KeioUser == "" {
-		return fmt.Errorf("KEIO_USERが設定されていません")
+	if len(c.AssignmentSources) == 0 {
+		return fmt.Errorf("ASSIGNMENT_SOURCEが設定されていません")
 	}
-	if c.KeioPass == "" {
-		return fmt.Errorf("KEIO_PASSが設定されていません")
+	// フィクスチャのみの場合はK-LMSにログインしない
+	if c.NeedsBrowser() {
+		if c.KeioUser == "" {
+			return fmt.Errorf("KEIO_USERが設定されていません")
+		}
+		if c.KeioPass == "" {
+			return fmt.Errorf("KEIO_PASSが設定されていません")
+		}
 	}
-	if c.GeminiAPIKey == "" {
+	if c.UsesSource("gemini") && c.GeminiAPIKey == "" {
 		return fmt.Errorf("GEMINI_API_KEYが設定されていません")
 	}
+	if c.UsesSource("openai") && c.OpenAIModel == "" {
+		return fmt.Errorf("OPENAI_MODELが設定されていません")
+	}
 	// LINEとGmailはオプションなのでチェックしない
 	
 	return nil
 }
 
+// UsesSource は指定した課題ソースが有効かを返します
+func (c *Config) UsesSource(name string) bool {
+	for _, s := range c.AssignmentSources {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsBrowser はK-LMSをブラウザで開く必要があるかを返します（fixtureのみなら不要）
+func (c *Config) NeedsBrowser() bool {
+	for _, s := range c.AssignmentSources {
+		if s != "fixture" {
+			return true
+		}
+	}
+	return false
+}
+
+func getEnvDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// splitList はカンマ区切りの値を分割します（空要素は除外）
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, strings.ToLower(v))
+		}
+	}
+	return list
+}
+
+// parseDurations は「72h,24h,3h」のようなカンマ区切りの期間を解析します（「3d」のような日単位も可）
+func parseDurations(s string) ([]time.Duration, error) {
+	var durations []time.Duration
+	for _, v := range splitList(s) {
+		var d time.Duration
+		var err error
+		if days := strings.TrimSuffix(v, "d"); days != v {
+			var n int
+			if n, err = strconv.Atoi(days); err == nil {
+				d = time.Duration(n) * 24 * time.Hour
+			}
+		} else {
+			d, err = time.ParseDuration(v)
+		}
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("期間の指定が不正です: %q", v)
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
+
+// loadCourseStyles は科目ごとのカテゴリ・色の設定ファイルを読み込みます（なければ空）
+func loadCourseStyles(file string) ([]CourseStyle, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var styles []CourseStyle
+	if err := json.Unmarshal(data, &styles); err != nil {
+		return nil, fmt.Errorf("%s の解析エラー: %v", file, err)
+	}
+	return styles, nil
+}
+
+// CourseStyleFor は科目名に一致する設定を返します（先に書いたものを優先。なければnil）
+func (c *Config) CourseStyleFor(course string) *CourseStyle {
+	for i := range c.ICSCourseStyles {
+		if m := c.ICSCourseStyles[i].Match; m != "" && strings.Contains(course, m) {
+			return &c.ICSCourseStyles[i]
+		}
+	}
+	return nil
+}
+
+// Quotas は使用回数の上限とリセット時刻を返します（storage.ConfigureQuotas に渡します）
+func (c *Config) Quotas() storage.QuotaConfig {
+	return storage.QuotaConfig{
+		Limits: map[storage.Quota]int{
+			storage.QuotaGemini: c.MaxGeminiPerDay,
+			storage.QuotaLine:   c.MaxLinePerDay,
+			storage.QuotaGmail:  c.MaxGmailPerDay,
+		},
+		ResetAt: c.QuotaResetAt,
+	}
+}
+
+// IsActiveAt は t がチェックする時間帯（ACTIVE_HOURS）に含まれるかを返します
+// 「22:00-6:00」のように日をまたぐ指定にも対応します
+// 時間帯は日本時間で判定します（UTCのサーバーで動かしても同じ時間帯になるように）
+func (c *Config) IsActiveAt(t time.Time) bool {
+	if c.ActiveHoursStart == c.ActiveHoursEnd {
+		return true
+	}
+	t = t.In(storage.JST)
+	m := t.Hour()*60 + t.Minute()
+	if c.ActiveHoursStart < c.ActiveHoursEnd {
+		return m >= c.ActiveHoursStart && m < c.ActiveHoursEnd
+	}
+	return m >= c.ActiveHoursStart || m < c.ActiveHoursEnd
+}
+
+// parseHours は「8-24」「8:00-24:00」のような時間帯を0時からの分に変換します
+func parseHours(s string) (int, int, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("「開始-終了」の形式で指定してください: %q", s)
+	}
+	var minutes [2]int
+	for i, p := range parts {
+		m, err := parseClock(p)
+		if err != nil {
+			return 0, 0, err
+		}
+		minutes[i] = m
+	}
+	return minutes[0], minutes[1], nil
+}
+
+// parseClock は「8」「8:00」のような時刻を0時からの分に変換します（24:00は0時）
+func parseClock(p string) (int, error) {
+	p = strings.TrimSpace(p)
+	hm := strings.SplitN(p, ":", 2)
+	h, err := strconv.Atoi(hm[0])
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("時刻が不正です: %q", p)
+	}
+	m := 0
+	if len(hm) == 2 {
+		if m, err = strconv.Atoi(hm[1]); err != nil || m < 0 || m > 59 || (h == 24 && m > 0) {
+			return 0, fmt.Errorf("時刻が不正です: %q", p)
+		}
+	}
+	return (h*60 + m) % (24 * 60), nil
+}
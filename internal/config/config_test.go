@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsActiveAtUsesJST(t *testing.T) {
+	start, end, err := parseHours("8:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{ActiveHoursStart: start, ActiveHoursEnd: end}
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		// UTCのサーバーの時計で渡されても日本時間で判定する
+		{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), true},    // 9:00 JST
+		{time.Date(2026, 1, 1, 14, 59, 0, 0, time.UTC), true},  // 23:59 JST
+		{time.Date(2026, 1, 1, 15, 0, 0, 0, time.UTC), false},  // 0:00 JST
+		{time.Date(2026, 1, 1, 22, 59, 0, 0, time.UTC), false}, // 7:59 JST
+		{time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC), true},   // 8:00 JST
+	}
+	for _, tt := range tests {
+		if got := cfg.IsActiveAt(tt.at); got != tt.want {
+			t.Errorf("IsActiveAt(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestIsActiveAtOvernight(t *testing.T) {
+	start, end, err := parseHours("22-6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{ActiveHoursStart: start, ActiveHoursEnd: end}
+	jst := time.FixedZone("JST", 9*60*60)
+	for hour, want := range map[int]bool{21: false, 22: true, 3: true, 6: false} {
+		if got := cfg.IsActiveAt(time.Date(2026, 1, 1, hour, 0, 0, 0, jst)); got != want {
+			t.Errorf("%d:00 JST: got %v, want %v", hour, got, want)
+		}
+	}
+	if !(&Config{}).IsActiveAt(time.Now()) {
+		t.Error("no ACTIVE_HOURS should always be active")
+	}
+}
@@ -0,0 +1,280 @@
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"klms-go/internal/ocr"
+)
+
+// Kind は変更の種類です
+type Kind string
+
+const (
+	Added           Kind = "added"            // 新しい課題
+	Removed         Kind = "removed"          // 期限前に消えた課題
+	DeadlineChanged Kind = "deadline_changed" // 期限の変更
+	TitleChanged    Kind = "title_changed"    // 課題名の修正
+	CourseChanged   Kind = "course_changed"   // 科目名の修正（OCRの読み違いの訂正など）
+)
+
+// Item は識別キー付きの課題です
+// Key は課題名や期限が変わっても引き継がれます
+type Item struct {
+	Key string `json:"key"`
+	ocr.Assignment
+
+	// Sequence は課題名・科目名・期限が変わった回数です（カレンダーの SEQUENCE に使います）
+	Sequence int `json:"sequence,omitempty"`
+}
+
+// Change は前回から今回への1件の変更です
+type Change struct {
+	Kind     Kind            `json:"kind"`
+	Key      string          `json:"key"`
+	Old      *ocr.Assignment `json:"old,omitempty"`
+	New      *ocr.Assignment `json:"new,omitempty"`
+	Sequence int             `json:"sequence,omitempty"` // 変更後の Item.Sequence
+}
+
+// Key は課題の識別キーを作ります
+// 取得元のIDやURLがあればそれを使い、なければ科目名と課題名から作ります（期限は含めない）
+func Key(a ocr.Assignment) string {
+	switch {
+	case a.SourceID != "":
+		return a.SourceID
+	case a.URL != "":
+		return "url:" + a.URL
+	}
+	hash := sha256.Sum256([]byte(a.Course + "|" + a.Title))
+	return "text:" + hex.EncodeToString(hash[:])[:16]
+}
+
+// uniqueKey は他の課題と重ならない識別キーを作ります
+// 同じ科目に同じ名前の課題（毎週の「小テスト」など）がある場合は期限を加え、それでも重なる場合は連番を付けます
+func uniqueKey(a ocr.Assignment, used func(key string) bool) string {
+	key := Key(a)
+	if !used(key) {
+		return key
+	}
+	if a.SourceID == "" && a.URL == "" {
+		hash := sha256.Sum256([]byte(a.Course + "|" + a.Title + "|" + a.Deadline))
+		key = "text:" + hex.EncodeToString(hash[:])[:16]
+	}
+	base := key
+	for n := 2; used(key); n++ {
+		key = fmt.Sprintf("%s#%d", base, n)
+	}
+	return key
+}
+
+// Compare は前回の課題一覧と今回の課題一覧を比較し、変更点と今回の識別キー付き一覧を返します
+// 期限を過ぎて消えた課題は削除扱いにしません
+// taken は前回の一覧にない課題（期限切れ・提出済みの記録など）がすでに使っているキーかを返します（nil なら前回の一覧だけで判定）
+func Compare(prev []Item, curr []ocr.Assignment, taken func(key string, a ocr.Assignment) bool, now time.Time) ([]Change, []Item) {
+	matched := make([]bool, len(prev))
+	keys := make([]string, len(curr))
+	seqs := make([]int, len(curr))
+
+	// 科目名と期限が同じ課題の数（同じ日に同じ科目の課題が複数あるかを判定する）
+	prevSameDay, currSameDay := map[string]int{}, map[string]int{}
+	for _, p := range prev {
+		prevSameDay[p.Course+"|"+p.Deadline]++
+	}
+	for _, c := range curr {
+		currSameDay[c.Course+"|"+c.Deadline]++
+	}
+
+	// 一致の強さの順に対応付ける
+	// 同じ科目名・課題名の課題が複数ある場合も、期限まで一致するものを先に対応付けて取り違えないようにする
+	matchers := []func(p Item, c ocr.Assignment) bool{
+		// 1. 取得元のIDまたはURLが一致
+		func(p Item, c ocr.Assignment) bool {
+			return (p.SourceID != "" && p.SourceID == c.SourceID) || (p.URL != "" && p.URL == c.URL)
+		},
+		// 2. 科目名・課題名・期限が一致（変更なし）
+		func(p Item, c ocr.Assignment) bool {
+			return p.Course == c.Course && p.Title == c.Title && p.Deadline == c.Deadline
+		},
+		// 3. 科目名と課題名が一致（期限の変更）
+		// 期限を過ぎた課題は、同じ名前の次の課題（毎週の小テストなど）と取り違えないよう対象外にする
+		func(p Item, c ocr.Assignment) bool {
+			return p.Course == c.Course && p.Title == c.Title && !overdue(p.Deadline, now)
+		},
+		// 4. 科目名と期限が一致（課題名の修正）
+		// 同じ日に同じ科目の課題が複数ある場合は、別の課題を取り違えないよう課題名が似ているものだけ対応付ける
+		func(p Item, c ocr.Assignment) bool {
+			if p.Course != c.Course || p.Deadline != c.Deadline {
+				return false
+			}
+			sameDay := p.Course + "|" + p.Deadline
+			return (prevSameDay[sameDay] == 1 && currSameDay[sameDay] == 1) || similarTitle(p.Title, c.Title)
+		},
+		// 5. 課題名と期限が一致（科目名の修正）
+		func(p Item, c ocr.Assignment) bool {
+			return p.Title == c.Title && p.Deadline == c.Deadline
+		},
+	}
+
+	var changes []Change
+	for _, match := range matchers {
+		for ci, c := range curr {
+			if keys[ci] != "" {
+				continue
+			}
+			for pi, p := range prev {
+				if matched[pi] || !match(p, c) {
+					continue
+				}
+				matched[pi] = true
+				keys[ci] = p.Key
+				seqs[ci] = p.Sequence
+				if itemChanges := compareItem(p, c); len(itemChanges) > 0 {
+					seqs[ci]++
+					for _, ch := range itemChanges {
+						ch.Sequence = seqs[ci]
+						changes = append(changes, ch)
+					}
+				}
+				break
+			}
+		}
+	}
+
+	// 新しい課題のキーは、前回の一覧・今回の一覧・記録にある他の課題のキーと重ならないようにする
+	used := map[string]bool{}
+	for _, p := range prev {
+		used[p.Key] = true
+	}
+	for _, key := range keys {
+		used[key] = true
+	}
+
+	next := make([]Item, len(curr))
+	for ci, c := range curr {
+		if keys[ci] == "" {
+			keys[ci] = uniqueKey(c, func(key string) bool {
+				return used[key] || (taken != nil && taken(key, c))
+			})
+			used[keys[ci]] = true
+			added := c
+			changes = append(changes, Change{Kind: Added, Key: keys[ci], New: &added})
+		}
+		next[ci] = Item{Key: keys[ci], Assignment: c, Sequence: seqs[ci]}
+	}
+
+	for pi, p := range prev {
+		if matched[pi] {
+			continue
+		}
+		if deadline, err := ocr.ParseDeadline(p.Deadline); err == nil && deadline.Before(now) {
+			continue
+		}
+		removed := p.Assignment
+		changes = append(changes, Change{Kind: Removed, Key: p.Key, Old: &removed, Sequence: p.Sequence + 1})
+	}
+	return changes, next
+}
+
+// compareItem は対応付けられた課題の差分を返します
+func compareItem(p Item, c ocr.Assignment) []Change {
+	var changes []Change
+	old, cur := p.Assignment, c
+	if p.Deadline != c.Deadline {
+		changes = append(changes, Change{Kind: DeadlineChanged, Key: p.Key, Old: &old, New: &cur})
+	}
+	if p.Title != c.Title {
+		changes = append(changes, Change{Kind: TitleChanged, Key: p.Key, Old: &old, New: &cur})
+	}
+	if p.Course != c.Course {
+		changes = append(changes, Change{Kind: CourseChanged, Key: p.Key, Old: &old, New: &cur})
+	}
+	return changes
+}
+
+// similarTitle は課題名が似ているか（修正前後の同じ課題とみなせるか）を返します
+// 空白を除いた2文字ずつの組のうち、半分以上が共通していれば似ているとします
+func similarTitle(a, b string) bool {
+	pa, pb := bigrams(a), bigrams(b)
+	if len(pa) == 0 || len(pb) == 0 {
+		return strings.Join(strings.Fields(a), "") == strings.Join(strings.Fields(b), "")
+	}
+	common := 0
+	for bigram, n := range pa {
+		if m := pb[bigram]; m < n {
+			common += m
+		} else {
+			common += n
+		}
+	}
+	total := 0
+	for _, n := range pa {
+		total += n
+	}
+	for _, n := range pb {
+		total += n
+	}
+	return float64(2*common)/float64(total) >= 0.5
+}
+
+// bigrams は空白を除いた文字列の、隣り合う2文字の組とその数を返します
+func bigrams(s string) map[string]int {
+	runes := []rune(strings.Join(strings.Fields(s), ""))
+	pairs := map[string]int{}
+	for i := 0; i+1 < len(runes); i++ {
+		pairs[string(runes[i:i+2])]++
+	}
+	return pairs
+}
+
+// String は変更を通知用の1行に整形します
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("🆕 新しい課題: %s（%s）期限 %s", c.New.Title, c.New.Course, ocr.FormatDeadline(c.New.Deadline))
+	case Removed:
+		return fmt.Sprintf("🗑️ 課題が削除されました: %s（%s）", c.Old.Title, c.Old.Course)
+	case DeadlineChanged:
+		return fmt.Sprintf("⏰ %s の期限が %s から %s に変更されました（%s）", c.New.Title, shortDeadline(c.Old.Deadline), shortDeadline(c.New.Deadline), c.New.Course)
+	case TitleChanged:
+		return fmt.Sprintf("✏️ 課題名が「%s」から「%s」に変更されました（%s）", c.Old.Title, c.New.Title, c.New.Course)
+	case CourseChanged:
+		return fmt.Sprintf("📚 %s の科目名が「%s」から「%s」に修正されました", c.New.Title, c.Old.Course, c.New.Course)
+	}
+	return string(c.Kind)
+}
+
+// Summary は変更一覧を通知用のテキストに整形します
+func Summary(changes []Change) string {
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		lines[i] = c.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Filter は指定した種類の変更だけを返します
+func Filter(changes []Change, kinds ...Kind) []Change {
+	var filtered []Change
+	for _, c := range changes {
+		for _, k := range kinds {
+			if c.Kind == k {
+				filtered = append(filtered, c)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// shortDeadline は期限を「1/13 23:59」の形式にします
+func shortDeadline(deadline string) string {
+	t, err := time.Parse(ocr.DeadlineLayout, deadline)
+	if err != nil {
+		return deadline
+	}
+	return t.Format("1/2 15:04")
+}
@@ -0,0 +1,218 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"klms-go/internal/ocr"
+	"klms-go/internal/storage"
+)
+
+func quiz(deadline string) ocr.Assignment {
+	return ocr.Assignment{Course: "統計学基礎 (藪 友良)", Title: "小テスト", Deadline: deadline}
+}
+
+func TestCompareKeepsSameTitleAssignmentsApart(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, ocr.JST)
+	curr := []ocr.Assignment{quiz("2026-10-07 23:59"), quiz("2026-10-14 23:59")}
+
+	changes, items := Compare(nil, curr, nil, now)
+	if len(changes) != 2 || len(Filter(changes, Added)) != 2 {
+		t.Fatalf("変更: %v（新規2件のはず）", changes)
+	}
+	if items[0].Key == items[1].Key {
+		t.Fatalf("2つの課題が同じキー %s になりました", items[0].Key)
+	}
+
+	// 順番が入れ替わっても期限で対応付け、変更なしとして扱う
+	changes, next := Compare(items, []ocr.Assignment{curr[1], curr[0]}, nil, now)
+	if len(changes) != 0 {
+		t.Fatalf("変更: %v（変更なしのはず）", changes)
+	}
+	if next[0].Key != items[1].Key || next[1].Key != items[0].Key {
+		t.Fatalf("キーが入れ替わりました: %v → %v", items, next)
+	}
+}
+
+func TestCompareDoesNotReuseExpiredAssignmentKey(t *testing.T) {
+	now := time.Date(2026, 10, 8, 12, 0, 0, 0, ocr.JST)
+	prev := []Item{{Key: Key(quiz("2026-10-07 23:59")), Assignment: quiz("2026-10-07 23:59")}}
+
+	changes, items := Compare(prev, []ocr.Assignment{quiz("2026-10-14 23:59")}, nil, now)
+	if len(changes) != 1 || changes[0].Kind != Added {
+		t.Fatalf("変更: %v（新規1件のはず）", changes)
+	}
+	if items[0].Key == prev[0].Key {
+		t.Fatalf("翌週の小テストが期限切れの課題のキー %s を使っています", items[0].Key)
+	}
+
+	// 記録に残っている課題のキーも避ける
+	taken := func(key string, a ocr.Assignment) bool { return key == prev[0].Key }
+	_, items = Compare(nil, []ocr.Assignment{quiz("2026-10-14 23:59")}, taken, now)
+	if items[0].Key == prev[0].Key {
+		t.Fatalf("キー %s が記録にある課題と重なっています", items[0].Key)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, ocr.JST)
+	report := func(title, deadline string) ocr.Assignment {
+		return ocr.Assignment{Course: "経済学", Title: title, Deadline: deadline}
+	}
+	item := func(key string, a ocr.Assignment) Item { return Item{Key: key, Assignment: a} }
+
+	// want は変更の種類とキー、keys は今回の一覧のキー（空なら新しいキー）です
+	type change struct {
+		Kind Kind
+		Key  string
+	}
+	tests := []struct {
+		name string
+		prev []Item
+		curr []ocr.Assignment
+		want []change
+		keys []string
+	}{
+		{
+			name: "期限の変更",
+			prev: []Item{item("k1", quiz("2026-10-07 23:59"))},
+			curr: []ocr.Assignment{quiz("2026-10-09 23:59")},
+			want: []change{{DeadlineChanged, "k1"}},
+			keys: []string{"k1"},
+		},
+		{
+			name: "課題名の修正",
+			prev: []Item{item("k1", report("第3回 レポート", "2026-10-07 23:59"))},
+			curr: []ocr.Assignment{report("第3回 レポート課題", "2026-10-07 23:59")},
+			want: []change{{TitleChanged, "k1"}},
+			keys: []string{"k1"},
+		},
+		{
+			// 同じ日に同じ科目の課題が1つずつなら、課題名が大きく変わっても同じ課題とみなす
+			name: "同じ日に1つだけなら課題名が違っても修正とみなす",
+			prev: []Item{item("k1", report("レポート", "2026-10-07 23:59"))},
+			curr: []ocr.Assignment{report("期末課題", "2026-10-07 23:59")},
+			want: []change{{TitleChanged, "k1"}},
+			keys: []string{"k1"},
+		},
+		{
+			// 同じ日に同じ科目の課題が複数あるときは、別の課題を名前の修正として通知しない
+			name: "同じ日の別の課題は取り違えない",
+			prev: []Item{item("k1", report("第3回 レポート", "2026-10-07 23:59")), item("k2", report("確認テスト", "2026-10-07 23:59"))},
+			curr: []ocr.Assignment{report("第3回 レポート", "2026-10-07 23:59"), report("アンケート", "2026-10-07 23:59")},
+			want: []change{{Added, ""}, {Removed, "k2"}},
+			keys: []string{"k1", ""},
+		},
+		{
+			name: "同じ日に複数あっても課題名が似ていれば修正とみなす",
+			prev: []Item{item("k1", report("第3回 レポート", "2026-10-07 23:59")), item("k2", report("確認テスト", "2026-10-07 23:59"))},
+			curr: []ocr.Assignment{report("第3回 レポート", "2026-10-07 23:59"), report("確認テスト（再提出）", "2026-10-07 23:59")},
+			want: []change{{TitleChanged, "k2"}},
+			keys: []string{"k1", "k2"},
+		},
+		{
+			name: "科目名の修正",
+			prev: []Item{item("k1", ocr.Assignment{Course: "統計学基礎", Title: "小テスト", Deadline: "2026-10-07 23:59"})},
+			curr: []ocr.Assignment{quiz("2026-10-07 23:59")},
+			want: []change{{CourseChanged, "k1"}},
+			keys: []string{"k1"},
+		},
+		{
+			// 取得元のIDが同じなら、課題名・期限が両方変わっても同じ課題
+			name: "取得元のIDで対応付ける",
+			prev: []Item{item("canvas:assignment:1", ocr.Assignment{Course: "経済学", Title: "レポート", Deadline: "2026-10-07 23:59", SourceID: "canvas:assignment:1"})},
+			curr: []ocr.Assignment{{Course: "経済学", Title: "期末レポート", Deadline: "2026-10-10 23:59", SourceID: "canvas:assignment:1"}},
+			want: []change{{DeadlineChanged, "canvas:assignment:1"}, {TitleChanged, "canvas:assignment:1"}},
+			keys: []string{"canvas:assignment:1"},
+		},
+		{
+			name: "URLで対応付ける",
+			prev: []Item{item("url:https://lms.example/a/1", ocr.Assignment{Course: "経済", Title: "レポート", Deadline: "2026-10-07 23:59", URL: "https://lms.example/a/1"})},
+			curr: []ocr.Assignment{{Course: "経済学", Title: "期末レポート", Deadline: "2026-10-07 23:59", URL: "https://lms.example/a/1"}},
+			want: []change{{TitleChanged, "url:https://lms.example/a/1"}, {CourseChanged, "url:https://lms.example/a/1"}},
+			keys: []string{"url:https://lms.example/a/1"},
+		},
+		{
+			name: "期限前に消えた課題は削除",
+			prev: []Item{item("k1", quiz("2026-10-07 23:59"))},
+			want: []change{{Removed, "k1"}},
+		},
+		{
+			name: "期限後に消えた課題は削除にしない",
+			prev: []Item{item("k1", quiz("2026-09-30 23:59"))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, items := Compare(tt.prev, tt.curr, nil, now)
+			var got []change
+			for _, c := range changes {
+				key := c.Key
+				if c.Kind == Added {
+					key = ""
+				}
+				got = append(got, change{c.Kind, key})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("変更: %v, want %v", got, tt.want)
+			}
+			for i, want := range tt.keys {
+				if want != "" && items[i].Key != want {
+					t.Errorf("%d 件目のキー: %s, want %s", i, items[i].Key, want)
+				}
+				if want == "" {
+					for _, p := range tt.prev {
+						if items[i].Key == p.Key {
+							t.Errorf("%d 件目の新しい課題が前回の課題のキー %s を使っています", i, p.Key)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompareSequence(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, ocr.JST)
+	prev := []Item{{Key: "text:abc", Assignment: quiz("2026-10-07 23:59"), Sequence: 2}}
+
+	changes, items := Compare(prev, []ocr.Assignment{quiz("2026-10-09 23:59")}, nil, now)
+	if len(changes) != 1 || changes[0].Kind != DeadlineChanged || changes[0].Sequence != 3 || items[0].Sequence != 3 {
+		t.Fatalf("変更: %v, 課題: %v（SEQUENCE は 3 のはず）", changes, items)
+	}
+
+	changes, _ = Compare(items, nil, nil, now)
+	if len(changes) != 1 || changes[0].Kind != Removed || changes[0].Sequence != 4 {
+		t.Fatalf("変更: %v（SEQUENCE 4 の削除のはず）", changes)
+	}
+}
+
+func TestCompareReappearance(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, ocr.JST)
+	h := &storage.History{}
+	a := quiz("2026-10-07 23:59")
+
+	_, items := Compare(nil, []ocr.Assignment{a}, nil, now)
+	RecordHistory(h, items, nil, "dom", now)
+	key := items[0].Key
+
+	// 一度消える（予定を SEQUENCE 1 で取り消す）
+	now = now.Add(time.Hour)
+	changes, next := Compare(items, nil, nil, now)
+	if len(changes) != 1 || changes[0].Kind != Removed {
+		t.Fatalf("変更: %v（削除1件のはず）", changes)
+	}
+	RecordHistory(h, next, changes, "dom", now)
+
+	// 同じ課題が再び現れたら同じキーで、取り消した版より新しい SEQUENCE を付ける
+	now = now.Add(time.Hour)
+	changes, next = Compare(next, []ocr.Assignment{a}, nil, now)
+	Reappear(h, changes, next)
+	if len(changes) != 1 || changes[0].Kind != Added || changes[0].Key != key {
+		t.Fatalf("変更: %v（キー %s の新規1件のはず）", changes, key)
+	}
+	if changes[0].Sequence != 2 || next[0].Sequence != 2 {
+		t.Errorf("SEQUENCE: 変更 %d, 課題 %d（2 のはず）", changes[0].Sequence, next[0].Sequence)
+	}
+}
@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"time"
+
+	"klms-go/internal/ocr"
+	"klms-go/internal/storage"
+)
+
+// RecordHistory は今回の課題一覧と変更を課題の記録に反映し、古い記録を整理します
+func RecordHistory(h *storage.History, items []Item, changes []Change, source string, now time.Time) {
+	observations := make([]storage.Observation, 0, len(items))
+	for _, item := range items {
+		observations = append(observations, storage.Observation{
+			Key:       item.Key,
+			Course:    item.Course,
+			Title:     item.Title,
+			Deadline:  item.Deadline,
+			URL:       item.URL,
+			Source:    source,
+			Completed: item.Completed,
+			Overdue:   overdue(item.Deadline, now),
+			Sequence:  item.Sequence,
+		})
+	}
+	h.Observe(observations, func(r *storage.Record) bool { return overdue(r.Deadline, now) }, now)
+
+	// 取り消した予定の SEQUENCE を残し、同じ課題が再び現れたときにそれより新しい版を作れるようにする
+	for _, c := range Filter(changes, Removed) {
+		if r := h.Get(c.Key); r != nil && c.Sequence > r.Sequence {
+			r.Sequence = c.Sequence
+		}
+	}
+	h.Prune(now, storage.HistoryRetention)
+}
+
+// Reappear は一度削除された課題が同じキーで再び現れた場合に、取り消した予定より新しい SEQUENCE を付け直します
+// SEQUENCE が取り消しの版以下だと、カレンダーアプリは再登録を無視して予定を取り消したままにします
+func Reappear(h *storage.History, changes []Change, items []Item) {
+	sequences := map[string]int{}
+	for i, c := range changes {
+		r := h.Get(c.Key)
+		if c.Kind != Added || r == nil || r.Status != storage.StatusRemoved {
+			continue
+		}
+		changes[i].Sequence = r.Sequence + 1
+		sequences[c.Key] = changes[i].Sequence
+	}
+	for i, item := range items {
+		if seq, ok := sequences[item.Key]; ok {
+			items[i].Sequence = seq
+		}
+	}
+}
+
+// overdue は期限を過ぎているかを返します（期限を解釈できなければ false）
+func overdue(deadline string, now time.Time) bool {
+	t, err := ocr.ParseDeadline(deadline)
+	return err == nil && t.Before(now)
+}
@@ -0,0 +1,42 @@
+package diff
+
+import (
+	"time"
+
+	"klms-go/internal/storage"
+)
+
+// snapshotUpdatedAtKey は課題一覧を保存した時刻のキーです
+const snapshotUpdatedAtKey = "updated_at"
+
+// LoadSnapshot は前回の課題一覧を読み込みます（なければ空）
+func LoadSnapshot() ([]Item, error) {
+	var items []Item
+	if _, err := storage.Load(storage.BucketAssignments, storage.KeyAssignments, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SaveSnapshot は今回の課題一覧を保存します
+func SaveSnapshot(items []Item) error {
+	return storage.Update(func(tx storage.Tx) error { return PutSnapshot(tx, items) })
+}
+
+// PutSnapshot はトランザクション内で課題一覧を保存します
+func PutSnapshot(tx storage.Tx, items []Item) error {
+	if err := storage.PutJSON(tx, storage.BucketAssignments, storage.KeyAssignments, items); err != nil {
+		return err
+	}
+	return tx.Put(storage.BucketAssignments, snapshotUpdatedAtKey, []byte(time.Now().Format(time.RFC3339Nano)))
+}
+
+// SnapshotUpdatedAt は課題一覧を最後に保存した時刻を返します（なければゼロ）
+func SnapshotUpdatedAt() time.Time {
+	var t time.Time
+	storage.View(func(tx storage.Tx) error {
+		t, _ = time.Parse(time.RFC3339Nano, string(tx.Get(storage.BucketAssignments, snapshotUpdatedAtKey)))
+		return nil
+	})
+	return t
+}
@@ -0,0 +1,121 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"klms-go/internal/diff"
+	"klms-go/internal/ics"
+)
+
+// PathPrefix はカレンダーのURLの先頭です（/calendar/<トークン>.ics）
+const PathPrefix = "/calendar/"
+
+// CalendarName は購読したカレンダーアプリに表示される名前です
+const CalendarName = "K-LMS 課題"
+
+// Loader は配信する課題一覧と、その更新時刻を返します
+type Loader func() ([]diff.Item, time.Time, error)
+
+// Server は既知の課題すべてを購読用のカレンダーとして配信します
+// カレンダーアプリに一度登録すれば、定期的に再取得して最新の状態になります
+type Server struct {
+	Token   string
+	Options ics.Options
+	Load    Loader
+}
+
+// LoadSnapshot は保存済みの課題一覧を読み込む Loader です
+func LoadSnapshot() ([]diff.Item, time.Time, error) {
+	items, err := diff.LoadSnapshot()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return items, diff.SnapshotUpdatedAt(), nil
+}
+
+// ServeHTTP は /calendar/<トークン>.ics へのリクエストに答えます
+// トークンが違う場合は存在を知らせないよう404を返します
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, PathPrefix)
+	token := strings.TrimSuffix(name, ".ics")
+	if name == r.URL.Path || token == name || !s.validToken(token) {
+		http.NotFound(w, r)
+		return
+	}
+
+	items, modTime, err := s.Load()
+	if err != nil {
+		log.Printf("⚠️ カレンダー配信: 課題一覧の読み込みエラー: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	modTime = modTime.Truncate(time.Second)
+
+	// 内容が同じなら同じファイルになるよう、DTSTAMPには課題一覧の更新時刻を使う
+	opts := s.Options
+	opts.CalendarName = CalendarName
+	opts.Stamp = modTime
+	if opts.Stamp.IsZero() {
+		opts.Stamp = time.Unix(0, 0)
+	}
+	body := []byte(ics.GenerateICS(openItems(items), opts))
+	sum := sha256.Sum256(body)
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	// If-None-Match / If-Modified-Since の処理は ServeContent に任せる
+	http.ServeContent(w, r, "calendar.ics", modTime, bytes.NewReader(body))
+}
+
+func (s *Server) validToken(token string) bool {
+	return s.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// openItems は完了済みの課題を除きます
+func openItems(items []diff.Item) []diff.Item {
+	var open []diff.Item
+	for _, item := range items {
+		if !item.Completed {
+			open = append(open, item)
+		}
+	}
+	return open
+}
+
+// ListenAndServe は ctx が終了するまでカレンダーを配信します
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(PathPrefix, s)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	log.Printf("📡 カレンダーを配信しています: http://%s%s<トークン>.ics", addr, PathPrefix)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
@@ -0,0 +1,194 @@
+package feed
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"klms-go/internal/diff"
+	"klms-go/internal/ics"
+	"klms-go/internal/ocr"
+)
+
+const testToken = "0123456789abcdef0123"
+
+var testModTime = time.Date(2026, 12, 1, 9, 30, 15, 500, time.UTC)
+
+func newTestServer(t *testing.T) (*httptest.Server, *int) {
+	t.Helper()
+	loads := 0
+	s := &Server{
+		Token:   testToken,
+		Options: ics.Options{},
+		Load: func() ([]diff.Item, time.Time, error) {
+			loads++
+			return []diff.Item{
+				{Key: "a", Assignment: ocr.Assignment{Course: "情報処理", Title: "第8回 演習", Deadline: "2026-12-03 23:59"}},
+				{Key: "b", Assignment: ocr.Assignment{Course: "経済学", Title: "提出済みのレポート", Deadline: "2026-12-04 23:59", Completed: true}},
+			}, testModTime, nil
+		},
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv, &loads
+}
+
+func do(t *testing.T, method, url string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestServeCalendar(t *testing.T) {
+	srv, _ := newTestServer(t)
+	resp, body := do(t, http.MethodGet, srv.URL+PathPrefix+testToken+".ics", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ステータス: %s", resp.Status)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/calendar; charset=utf-8" {
+		t.Errorf("Content-Type: %q", got)
+	}
+	if resp.Header.Get("ETag") == "" {
+		t.Error("ETag がありません")
+	}
+	if got := resp.Header.Get("Last-Modified"); got != testModTime.Truncate(time.Second).Format(http.TimeFormat) {
+		t.Errorf("Last-Modified: %q", got)
+	}
+	if got := resp.Header.Get("Cache-Control"); !strings.Contains(got, "private") {
+		t.Errorf("Cache-Control: %q", got)
+	}
+	if !strings.Contains(body, "BEGIN:VCALENDAR") || !strings.Contains(body, "X-WR-CALNAME:"+CalendarName) {
+		t.Errorf("カレンダーになっていません:\n%s", body)
+	}
+	if !strings.Contains(body, "SUMMARY:情報処理: 第8回 演習") {
+		t.Errorf("未完了の課題がありません:\n%s", body)
+	}
+	if strings.Contains(body, "提出済みのレポート") {
+		t.Errorf("完了済みの課題が含まれています:\n%s", body)
+	}
+	// DTSTAMP は課題一覧の更新時刻（同じ内容なら同じファイルになる）
+	if !strings.Contains(body, "DTSTAMP:20261201T093015Z") {
+		t.Errorf("DTSTAMP が課題一覧の更新時刻になっていません:\n%s", body)
+	}
+
+	// 同じ内容なら ETag も同じ
+	again, _ := do(t, http.MethodGet, srv.URL+PathPrefix+testToken+".ics", nil)
+	if again.Header.Get("ETag") != resp.Header.Get("ETag") {
+		t.Errorf("ETag が変わりました: %q → %q", resp.Header.Get("ETag"), again.Header.Get("ETag"))
+	}
+}
+
+func TestServeRejectsWrongToken(t *testing.T) {
+	srv, loads := newTestServer(t)
+	for _, path := range []string{
+		PathPrefix + "wrong-token-0000000000.ics",
+		PathPrefix + ".ics",
+		PathPrefix + testToken, // 拡張子なし
+		PathPrefix,
+		"/" + testToken + ".ics",
+	} {
+		resp, body := do(t, http.MethodGet, srv.URL+path, nil)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: ステータス %s", path, resp.Status)
+		}
+		if strings.Contains(body, "VCALENDAR") {
+			t.Errorf("%s: カレンダーが返されました", path)
+		}
+	}
+	if *loads != 0 {
+		t.Errorf("トークンが違うのに課題一覧を読み込みました（%d 回）", *loads)
+	}
+}
+
+func TestServeEmptyTokenNeverMatches(t *testing.T) {
+	s := &Server{Load: func() ([]diff.Item, time.Time, error) { return nil, time.Time{}, nil }}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PathPrefix+".ics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("トークン未設定でもカレンダーが返されました: %d", rec.Code)
+	}
+}
+
+func TestServeConditionalRequests(t *testing.T) {
+	srv, _ := newTestServer(t)
+	url := srv.URL + PathPrefix + testToken + ".ics"
+	first, _ := do(t, http.MethodGet, url, nil)
+	etag := first.Header.Get("ETag")
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"If-None-Match が一致", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"If-None-Match が不一致", map[string]string{"If-None-Match": `"old"`}, http.StatusOK},
+		{"If-Modified-Since が更新時刻以降", map[string]string{"If-Modified-Since": testModTime.Format(http.TimeFormat)}, http.StatusNotModified},
+		{"If-Modified-Since が更新時刻より前", map[string]string{"If-Modified-Since": testModTime.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, http.MethodGet, url, tt.header)
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: ステータス %s", tt.name, resp.Status)
+		}
+		if tt.want == http.StatusNotModified && body != "" {
+			t.Errorf("%s: 304 に本文があります", tt.name)
+		}
+	}
+}
+
+func TestServeHead(t *testing.T) {
+	srv, _ := newTestServer(t)
+	resp, body := do(t, http.MethodHead, srv.URL+PathPrefix+testToken+".ics", nil)
+	if resp.StatusCode != http.StatusOK || body != "" {
+		t.Fatalf("HEAD: %s, 本文 %d バイト", resp.Status, len(body))
+	}
+	if resp.Header.Get("ETag") == "" || resp.Header.Get("Content-Length") == "0" {
+		t.Errorf("HEAD のヘッダー: %v", resp.Header)
+	}
+}
+
+func TestServeRejectsOtherMethods(t *testing.T) {
+	srv, loads := newTestServer(t)
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		resp, _ := do(t, method, srv.URL+PathPrefix+testToken+".ics", nil)
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("%s: ステータス %s", method, resp.Status)
+		}
+		if got := resp.Header.Get("Allow"); got != "GET, HEAD" {
+			t.Errorf("%s: Allow %q", method, got)
+		}
+	}
+	if *loads != 0 {
+		t.Errorf("GET 以外で課題一覧を読み込みました（%d 回）", *loads)
+	}
+}
+
+func TestServeLoadError(t *testing.T) {
+	s := &Server{Token: testToken, Load: func() ([]diff.Item, time.Time, error) {
+		return nil, time.Time{}, errors.New("データベースを開けません")
+	}}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PathPrefix+testToken+".ics", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("ステータス: %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "データベース") {
+		t.Error("内部のエラーがレスポンスに含まれています")
+	}
+}
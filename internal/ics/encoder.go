@@ -0,0 +1,261 @@
+package ics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iCalendar（RFC 5545）の書式に関する定数
+const (
+	ProdID = "-//K-LMS Auto//JP"
+	TZID   = "Asia/Tokyo"
+
+	crlf          = "\r\n"
+	maxLineOctets = 75 // 1行の最大オクテット数（改行を除く）
+
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+	utcLayout      = "20060102T150405Z"
+)
+
+// Calendar はVCALENDARです
+type Calendar struct {
+	Method string // PUBLISH / CANCEL（空なら出力しない）
+	Name   string // カレンダー名（購読時に表示される。空なら出力しない）
+	Events []Event
+}
+
+// Event はVEVENTです
+type Event struct {
+	UID         string
+	Sequence    int       // 内容を更新するたびに増やす（カレンダーアプリが新しい版で上書きする）
+	Status      string    // CANCELLED など（空なら出力しない）
+	Stamp       time.Time // DTSTAMP（UTCで出力されます）
+	Start       time.Time // DTSTART（Asia/Tokyoの現地時刻で出力されます）
+	End         time.Time // DTEND（Start と同じならDTENDを省略し、長さ0の予定になります）
+	AllDay      bool      // 終日の予定（Start の日付だけを使います）
+	Summary     string
+	Description string
+	URL         string
+	Categories  []string
+	Color       string   // RFC 7986 の COLOR（CSSの色名）
+	Alarms      []string // VALARMのトリガー（例: -P1D）
+
+	// Deadline はアラームの基準になる時刻です（ゼロなら DTSTART が基準）
+	// 予定の終了と一致すれば RELATED=END、終日の予定などでは絶対時刻のトリガーにします
+	Deadline time.Time
+}
+
+// Encode はカレンダーをiCalendar形式（CRLF改行・75オクテットで折り返し）に変換します
+func (c *Calendar) Encode() string {
+	var e encoder
+	e.prop("BEGIN", "VCALENDAR")
+	e.prop("VERSION", "2.0")
+	e.prop("PRODID", ProdID)
+	e.prop("CALSCALE", "GREGORIAN")
+	if c.Method != "" {
+		e.prop("METHOD", c.Method)
+	}
+	if c.Name != "" {
+		e.prop("NAME", EscapeText(c.Name))
+		e.prop("X-WR-CALNAME", EscapeText(c.Name))
+	}
+	if len(c.Events) > 0 {
+		writeTimezone(&e)
+	}
+	for _, ev := range c.Events {
+		ev.encode(&e)
+	}
+	e.prop("END", "VCALENDAR")
+	return e.sb.String()
+}
+
+func (ev Event) encode(e *encoder) {
+	e.prop("BEGIN", "VEVENT")
+	e.prop("UID", ev.UID)
+	e.prop("DTSTAMP", ev.Stamp.UTC().Format(utcLayout))
+	e.prop("SEQUENCE", strconv.Itoa(ev.Sequence))
+	if ev.Status != "" {
+		e.prop("STATUS", ev.Status)
+	}
+	switch {
+	case ev.AllDay:
+		day := ev.Start.In(tokyo)
+		e.prop("DTSTART;VALUE=DATE", day.Format(dateLayout))
+		e.prop("DTEND;VALUE=DATE", day.AddDate(0, 0, 1).Format(dateLayout))
+	case ev.End.IsZero() || ev.End.Equal(ev.Start):
+		e.prop("DTSTART;TZID="+TZID, localTime(ev.Start))
+	default:
+		e.prop("DTSTART;TZID="+TZID, localTime(ev.Start))
+		e.prop("DTEND;TZID="+TZID, localTime(ev.End))
+	}
+	e.prop("SUMMARY", EscapeText(ev.Summary))
+	if ev.Description != "" {
+		e.prop("DESCRIPTION", EscapeText(ev.Description))
+	}
+	if ev.URL != "" {
+		e.prop("URL", ev.URL)
+	}
+	if len(ev.Categories) > 0 {
+		escaped := make([]string, len(ev.Categories))
+		for i, c := range ev.Categories {
+			escaped[i] = EscapeText(c)
+		}
+		e.prop("CATEGORIES", strings.Join(escaped, ","))
+	}
+	if ev.Color != "" {
+		e.prop("COLOR", ev.Color)
+	}
+	for _, trigger := range ev.Alarms {
+		e.prop("BEGIN", "VALARM")
+		e.prop("ACTION", "DISPLAY")
+		e.prop("DESCRIPTION", EscapeText(ev.Summary))
+		name, value := ev.trigger(trigger)
+		e.prop(name, value)
+		e.prop("END", "VALARM")
+	}
+	e.prop("END", "VEVENT")
+}
+
+// trigger はアラームの TRIGGER プロパティの名前と値を返します
+// トリガーは既定で DTSTART からの相対時間なので、期限を基準にするには予定の形に合わせて書き換えます
+func (ev Event) trigger(duration string) (string, string) {
+	if ev.Deadline.IsZero() {
+		return "TRIGGER", duration
+	}
+	if !ev.AllDay {
+		// 長さ0の予定は DTEND を出力しないため RELATED=END は使えない（RFC 5545 3.8.6.3）
+		// DTSTART が期限と同じなら、既定の DTSTART からの相対時間で足りる
+		if ev.End.IsZero() || ev.End.Equal(ev.Start) {
+			if ev.Deadline.Equal(ev.Start) {
+				return "TRIGGER", duration
+			}
+		} else if ev.Deadline.Equal(ev.End) {
+			return "TRIGGER;RELATED=END", duration
+		}
+	}
+	d, err := ParseDuration(duration)
+	if err != nil {
+		return "TRIGGER", duration
+	}
+	return "TRIGGER;VALUE=DATE-TIME", ev.Deadline.Add(d).UTC().Format(utcLayout)
+}
+
+// ParseDuration はRFC 5545 の期間（例: -P1D, -PT3H, P1W）を time.Duration に変換します
+func ParseDuration(s string) (time.Duration, error) {
+	rest := s
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(rest, "-"):
+		sign, rest = -1, rest[1:]
+	case strings.HasPrefix(rest, "+"):
+		rest = rest[1:]
+	}
+	if !strings.HasPrefix(rest, "P") || len(rest) == 1 {
+		return 0, fmt.Errorf("期間の形式が不正です: %q", s)
+	}
+	rest = rest[1:]
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	var total time.Duration
+	for rest != "" {
+		if rest[0] == 'T' {
+			units = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+			rest = rest[1:]
+			continue
+		}
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(rest) {
+			return 0, fmt.Errorf("期間の形式が不正です: %q", s)
+		}
+		unit, ok := units[rest[i]]
+		if !ok {
+			return 0, fmt.Errorf("期間の形式が不正です: %q", s)
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			return 0, fmt.Errorf("期間の形式が不正です: %q", s)
+		}
+		total += time.Duration(n) * unit
+		rest = rest[i+1:]
+	}
+	return sign * total, nil
+}
+
+// writeTimezone はAsia/TokyoのVTIMEZONEを書き出します
+// 日本は夏時間がないため、標準時の定義1つだけで足ります
+func writeTimezone(e *encoder) {
+	e.prop("BEGIN", "VTIMEZONE")
+	e.prop("TZID", TZID)
+	e.prop("BEGIN", "STANDARD")
+	e.prop("DTSTART", "19700101T000000")
+	e.prop("TZOFFSETFROM", "+0900")
+	e.prop("TZOFFSETTO", "+0900")
+	e.prop("TZNAME", "JST")
+	e.prop("END", "STANDARD")
+	e.prop("END", "VTIMEZONE")
+}
+
+func localTime(t time.Time) string {
+	return t.In(tokyo).Format(dateTimeLayout)
+}
+
+// EscapeText はTEXT型の値をエスケープします（\ ; , と改行）
+func EscapeText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case ';':
+			sb.WriteString(`\;`)
+		case ',':
+			sb.WriteString(`\,`)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// FoldLine は1行を75オクテットごとに折り返します（CRLFを含まない）
+// 継続行は空白1文字で始まり、UTF-8の文字の途中では折り返しません
+func FoldLine(line string) string {
+	if len(line) <= maxLineOctets {
+		return line
+	}
+	var sb strings.Builder
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		sb.WriteString(line[:cut])
+		sb.WriteString(crlf + " ")
+		line = line[cut:]
+		limit = maxLineOctets - 1 // 先頭の空白の分
+	}
+	sb.WriteString(line)
+	return sb.String()
+}
+
+// encoder は折り返しとCRLFを処理しながらプロパティを書き出します
+type encoder struct {
+	sb strings.Builder
+}
+
+// prop は "名前:値" の1行を書き出します（name にはパラメータを含められます）
+func (e *encoder) prop(name, value string) {
+	e.sb.WriteString(FoldLine(name + ":" + value))
+	e.sb.WriteString(crlf)
+}
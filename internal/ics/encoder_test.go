@@ -0,0 +1,183 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// unfold は折り返された行を元に戻します（RFC 5545 3.1）
+func unfold(s string) []string {
+	s = strings.ReplaceAll(s, crlf+" ", "")
+	return strings.Split(strings.TrimSuffix(s, crlf), crlf)
+}
+
+// unescapeText は EscapeText の逆変換です
+func unescapeText(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' || s[i] == 'N' {
+				sb.WriteByte('\n')
+			} else {
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// splitEscaped は区切り文字で分割します（エスケープされた区切り文字では分割しない）
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func TestFoldLineMultibyte(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("造形・デザイン論（荒木 文果）", 10)
+	folded := FoldLine(line)
+
+	physical := strings.Split(folded, crlf)
+	if len(physical) < 2 {
+		t.Fatalf("line was not folded: %q", folded)
+	}
+	for i, l := range physical {
+		if len(l) > maxLineOctets {
+			t.Errorf("line %d is %d octets: %q", i, len(l), l)
+		}
+		if i > 0 && !strings.HasPrefix(l, " ") {
+			t.Errorf("continuation line %d does not start with a space: %q", i, l)
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("line %d splits a UTF-8 sequence: %q", i, l)
+		}
+	}
+	if got := unfold(folded)[0]; got != line {
+		t.Errorf("unfold(FoldLine(x)) = %q, want %q", got, line)
+	}
+	if short := "SUMMARY:短い"; FoldLine(short) != short {
+		t.Errorf("short line was folded: %q", FoldLine(short))
+	}
+}
+
+func TestEscapeTextRoundTrip(t *testing.T) {
+	tests := map[string]string{
+		`a,b;c\d`:       `a\,b\;c\\d`,
+		"1行目\n2行目":      `1行目\n2行目`,
+		"CRLF\r\nと\rCR": `CRLF\nと\nCR`,
+		"そのまま":          "そのまま",
+	}
+	for in, want := range tests {
+		got := EscapeText(in)
+		if got != want {
+			t.Errorf("EscapeText(%q) = %q, want %q", in, got, want)
+		}
+		normalized := strings.ReplaceAll(strings.ReplaceAll(in, "\r\n", "\n"), "\r", "\n")
+		if back := unescapeText(got); back != normalized {
+			t.Errorf("unescape(EscapeText(%q)) = %q", in, back)
+		}
+	}
+}
+
+func TestCalendarRoundTrip(t *testing.T) {
+	start := time.Date(2026, 1, 13, 22, 59, 0, 0, tokyo)
+	ev := Event{
+		UID:         "abc@klms-auto",
+		Sequence:    2,
+		Stamp:       time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Start:       start,
+		End:         start.Add(time.Hour),
+		Summary:     "統計学基礎 (藪 友良): 課題1; 第2回, 提出\\再提出" + strings.Repeat("あ", 40),
+		Description: "【課題】課題1\n【期限】2026-01-13 23:59",
+		Categories:  []string{"統計", "必修,重要"},
+		Alarms:      []string{"-P1D"},
+		Deadline:    start.Add(time.Hour),
+	}
+	cal := Calendar{Method: "PUBLISH", Name: "K-LMS 課題", Events: []Event{ev}}
+	out := cal.Encode()
+
+	if !strings.HasSuffix(out, crlf) || strings.Contains(strings.ReplaceAll(out, crlf, ""), "\n") {
+		t.Fatalf("output must use CRLF line endings only")
+	}
+
+	for _, l := range strings.Split(out, crlf) {
+		if len(l) > maxLineOctets || !utf8.ValidString(l) {
+			t.Errorf("physical line is not folded correctly: %q", l)
+		}
+	}
+
+	// 折り返しを戻してプロパティを読み込む（VALARM内は "VALARM/名前" として区別する）
+	props := map[string]string{}
+	var stack []string
+	for _, line := range unfold(out) {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			t.Fatalf("malformed line %q", line)
+		}
+		name, value := line[:i], line[i+1:]
+		switch name {
+		case "BEGIN":
+			stack = append(stack, value)
+			continue
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != value {
+				t.Fatalf("unbalanced END:%s (stack %v)", value, stack)
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		props[stack[len(stack)-1]+"/"+name] = value
+	}
+	if len(stack) != 0 {
+		t.Fatalf("unclosed components: %v", stack)
+	}
+
+	want := map[string]string{
+		"VCALENDAR/METHOD":            "PUBLISH",
+		"VCALENDAR/X-WR-CALNAME":      "K-LMS 課題",
+		"VEVENT/UID":                  ev.UID,
+		"VEVENT/SEQUENCE":             "2",
+		"VEVENT/DTSTAMP":              "20260101T000000Z",
+		"VEVENT/DTSTART;TZID=" + TZID: "20260113T225900",
+		"VEVENT/DTEND;TZID=" + TZID:   "20260113T235900",
+		"VEVENT/SUMMARY":              ev.Summary,
+		"VEVENT/DESCRIPTION":          ev.Description,
+		"VALARM/TRIGGER;RELATED=END":  "-P1D",
+		"STANDARD/TZOFFSETTO":         "+0900",
+	}
+	for key, value := range want {
+		got, ok := props[key]
+		if !ok {
+			t.Errorf("missing %s", key)
+			continue
+		}
+		if strings.HasSuffix(key, "/SUMMARY") || strings.HasSuffix(key, "/DESCRIPTION") || strings.HasSuffix(key, "CALNAME") {
+			got = unescapeText(got)
+		}
+		if got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+
+	var categories []string
+	for _, c := range splitEscaped(props["VEVENT/CATEGORIES"], ',') {
+		categories = append(categories, unescapeText(c))
+	}
+	if strings.Join(categories, "|") != "統計|必修,重要" {
+		t.Errorf("CATEGORIES = %q", categories)
+	}
+}
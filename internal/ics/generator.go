@@ -1,49 +1,150 @@
 package ics
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"strings"
 	"time"
+
+	"klms-go/internal/config"
+	"klms-go/internal/diff"
 	"klms-go/internal/ocr"
-	"klms-go/internal/storage"
 )
 
-func GenerateICS(assignments []ocr.Assignment) string {
-	var sb strings.Builder
+// tokyo は DTSTART/DTEND を出力するタイムゾーンです（VTIMEZONEと一致させる）
+var tokyo = ocr.JST
+
+// Options は予定の形・アラーム・科目ごとの色などの設定です
+type Options struct {
+	Style         string        // config.EventStyleBlock など（空なら block）
+	BlockDuration time.Duration // block の長さ（0なら1時間）
+	Alarms        []string      // VALARMのトリガー（期限からの時間。例: -P1D, -PT3H）
+	CourseStyle   func(course string) *config.CourseStyle
+
+	// CalendarName はカレンダー名です（購読用のフィードで使う）
+	CalendarName string
+
+	// Stamp は DTSTAMP に使う時刻です（ゼロなら現在時刻）
+	// 配信用のフィードでは課題一覧の更新時刻を指定し、内容が同じなら同じファイルになるようにします
+	Stamp time.Time
+}
+
+// NewOptions は設定から Options を作ります
+func NewOptions(cfg *config.Config) Options {
+	if cfg == nil {
+		return Options{}
+	}
+	return Options{
+		Style:         cfg.ICSEventStyle,
+		BlockDuration: cfg.ICSBlockDuration,
+		Alarms:        cfg.ICSAlarms,
+		CourseStyle:   cfg.CourseStyleFor,
+	}
+}
+
+// UID は課題の識別キーから予定のUIDを作ります
+// 識別キーは期限や課題名が変わっても変わらないため、カレンダー上の同じ予定が更新されます
+func UID(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:16]) + "@klms-auto"
+}
+
+// GenerateICS は課題一覧からカレンダーファイルの内容を作ります
+// 予定の形は opts.Style に従います（既定は期限の1時間前から期限までの予定）
+// 同じ課題を再度取り込むと、SEQUENCE が大きい方で既存の予定が更新されます
+func GenerateICS(items []diff.Item, opts Options) string {
+	cal := Calendar{Method: "PUBLISH", Name: opts.CalendarName}
+	now := opts.stamp()
+	for _, item := range items {
+		if ev, ok := opts.event(item, now); ok {
+			cal.Events = append(cal.Events, ev)
+		}
+	}
+	return cal.Encode()
+}
+
+// GenerateObject は課題1件分の予定だけを含むカレンダーを作ります（METHODなし）
+// CalDAVのカレンダーコレクションに保存するオブジェクトは METHOD を含めてはいけないため、こちらを使います
+func GenerateObject(item diff.Item, opts Options) (string, bool) {
+	ev, ok := opts.event(item, opts.stamp())
+	if !ok {
+		return "", false
+	}
+	cal := Calendar{Events: []Event{ev}}
+	return cal.Encode(), true
+}
+
+// GenerateCancelICS は削除された課題の予定を取り消すカレンダーファイルの内容を作ります
+// items の Sequence には取り消し後の値（前回 + 1）を設定してください
+func GenerateCancelICS(items []diff.Item, opts Options) string {
+	cal := Calendar{Method: "CANCEL"}
+	now := opts.stamp()
+	for _, item := range items {
+		if ev, ok := opts.event(item, now); ok {
+			ev.Status = "CANCELLED"
+			ev.Alarms = nil
+			cal.Events = append(cal.Events, ev)
+		}
+	}
+	return cal.Encode()
+}
 
-	sb.WriteString("BEGIN:VCALENDAR\n")
-	sb.WriteString("VERSION:2.0\n")
-	sb.WriteString("PRODID:-//K-LMS Auto//JP\n")
-	sb.WriteString("CALSCALE:GREGORIAN\n")
-	sb.WriteString("METHOD:PUBLISH\n")
+func (o Options) stamp() time.Time {
+	if o.Stamp.IsZero() {
+		return time.Now()
+	}
+	return o.Stamp
+}
+
+// event は課題1件分の予定を作ります（期限が解釈できなければ false）
+func (o Options) event(item diff.Item, now time.Time) (Event, bool) {
+	deadline, err := ocr.ParseDeadline(item.Deadline)
+	if err != nil {
+		return Event{}, false
+	}
+	key := item.Key
+	if key == "" {
+		key = diff.Key(item.Assignment)
+	}
 
-	for _, task := range assignments {
-		deadline, err := time.Parse("2006-01-02 15:04", task.Deadline)
-		if err != nil {
-			continue
+	ev := Event{
+		UID:      UID(key),
+		Sequence: item.Sequence,
+		Stamp:    now,
+		// タイトルは「科目名: 課題名」（カレンダー登録時の名称）
+		Summary:     fmt.Sprintf("%s: %s", item.Course, item.Title),
+		Description: fmt.Sprintf("【課題】%s\n【科目】%s\n【期限】%s\n\nK-LMS自動検知", item.Title, item.Course, item.Deadline),
+		URL:         item.URL,
+		Alarms:      o.Alarms,
+		Deadline:    deadline,
+	}
+	o.shape(&ev, deadline)
+	if o.CourseStyle != nil {
+		if style := o.CourseStyle(item.Course); style != nil {
+			ev.Categories = style.Categories
+			ev.Color = style.Color
+		}
+	}
+	return ev, true
+}
+
+// shape は予定の開始・終了を設定します
+func (o Options) shape(ev *Event, deadline time.Time) {
+	switch o.Style {
+	case config.EventStylePoint:
+		ev.Start, ev.End = deadline, deadline
+	case config.EventStyleAllDay:
+		// 0:00締切は前日の課題として扱う
+		day := deadline.In(tokyo)
+		if day.Hour() == 0 && day.Minute() == 0 {
+			day = day.AddDate(0, 0, -1)
+		}
+		ev.Start, ev.AllDay = day, true
+	default:
+		length := o.BlockDuration
+		if length <= 0 {
+			length = time.Hour
 		}
-		start := deadline.Add(-1 * time.Hour)
-
-		dtStart := start.Format("20060102T150405")
-		dtEnd := deadline.Format("20060102T150405")
-		now := time.Now().Format("20060102T150405")
-
-		uid := storage.GenerateID(task.Course, task.Title, task.Deadline)
-
-		sb.WriteString("BEGIN:VEVENT\n")
-		sb.WriteString(fmt.Sprintf("UID:%s@klms-auto\n", uid))
-		sb.WriteString(fmt.Sprintf("DTSTAMP:%s\n", now))
-		sb.WriteString(fmt.Sprintf("DTSTART;TZID=Asia/Tokyo:%s\n", dtStart))
-		sb.WriteString(fmt.Sprintf("DTEND;TZID=Asia/Tokyo:%s\n", dtEnd))
-		
-		// ★変更点: タイトルを「科目名: 課題名」に変更
-		// これでカレンダー登録時の名称が変わります
-		sb.WriteString(fmt.Sprintf("SUMMARY:%s: %s\n", task.Course, task.Title))
-		
-		sb.WriteString(fmt.Sprintf("DESCRIPTION:【課題】%s\\n【科目】%s\\n【期限】%s\\n\\nK-LMS自動検知\n", task.Title, task.Course, task.Deadline))
-		sb.WriteString("END:VEVENT\n")
-	}
-
-	sb.WriteString("END:VCALENDAR\n")
-	return sb.String()
-}
\ No newline at end of file
+		ev.Start, ev.End = deadline.Add(-length), deadline
+	}
+}
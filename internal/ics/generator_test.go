@@ -0,0 +1,48 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+
+	"klms-go/internal/config"
+	"klms-go/internal/diff"
+	"klms-go/internal/ocr"
+)
+
+func TestAlarmsAreRelativeToDeadline(t *testing.T) {
+	item := diff.Item{Key: "k", Assignment: ocr.Assignment{Course: "統計学", Title: "課題1", Deadline: "2026-01-13 23:59"}}
+	tests := []struct {
+		style string
+		want  string
+	}{
+		{config.EventStyleBlock, "TRIGGER;RELATED=END:-PT3H"},
+		// 長さ0の予定には DTEND がないので DTSTART（= 期限）からの相対時間にする
+		{config.EventStylePoint, "TRIGGER:-PT3H"},
+		// 23:59 JST の3時間前 = 11:59 UTC
+		{config.EventStyleAllDay, "TRIGGER;VALUE=DATE-TIME:20260113T115900Z"},
+	}
+	for _, tt := range tests {
+		out := GenerateICS([]diff.Item{item}, Options{Style: tt.style, Alarms: []string{"-PT3H"}})
+		if !strings.Contains(out, tt.want+crlf) {
+			t.Errorf("style %s: %q が含まれていません\n%s", tt.style, tt.want, out)
+		}
+		if strings.Contains(out, "RELATED=END") && !strings.Contains(out, "DTEND") {
+			t.Errorf("style %s: DTEND がないのに RELATED=END を使っています\n%s", tt.style, out)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]string{"-P1D": "-24h0m0s", "-PT3H": "-3h0m0s", "P1W": "168h0m0s", "-P1DT2H30M": "-26h30m0s", "+PT15M": "15m0s"}
+	for in, want := range tests {
+		d, err := ParseDuration(in)
+		if err != nil || d.String() != want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %s", in, d, err, want)
+		}
+	}
+	for _, in := range []string{"", "P", "1D", "-PT3", "PXD"} {
+		if _, err := ParseDuration(in); err == nil {
+			t.Errorf("ParseDuration(%q) がエラーになりません", in)
+		}
+	}
+}
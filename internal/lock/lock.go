@@ -0,0 +1,152 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RunLockFile は監視の実行中にロックするファイルです
+const RunLockFile = "data/run.lock"
+
+// pollInterval は待機中にロックを確認し直す間隔です
+const pollInterval = 2 * time.Second
+
+// errLocked は他のプロセスがファイルをロックしていることを表します（tryLock が返します）
+var errLocked = errors.New("locked")
+
+// Holder はロックを持っているプロセスの情報です（ロックファイルの内容）
+type Holder struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func (h Holder) String() string {
+	if h.PID == 0 {
+		return "（持ち主の情報を読み込めませんでした）"
+	}
+	return fmt.Sprintf("PID %d（%s, %s から実行中, コマンド: %s）", h.PID, h.Host, h.StartedAt.Format("2006-01-02 15:04:05"), h.Command)
+}
+
+// LockedError は他のプロセスがロックを持っている場合のエラーです
+type LockedError struct {
+	Holder Holder
+}
+
+func (e *LockedError) Error() string {
+	return "他のプロセスが実行中です: " + e.Holder.String()
+}
+
+// Lock は取得したロックです
+// ロックにはOSのファイルロック（flock / LockFileEx）を使うため、同時に取得できるのは1つのプロセスだけです
+// プロセスが強制終了した場合もOSがロックを解除するので、残ったロックを判定して消す必要はありません
+type Lock struct {
+	file *os.File
+	once sync.Once
+}
+
+// Acquire はロックを取得します
+// 他のプロセスがロックを持っている場合は最大 wait まで待ち、それでも取得できなければ *LockedError を返します
+func Acquire(path, command string, wait time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// ロックファイルは削除しない（削除すると、削除前のファイルをロックしたプロセスと
+	// 新しく作られたファイルをロックしたプロセスが同時に実行できてしまう）
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("ロックファイル（%s）を開けません: %v", path, err)
+	}
+
+	deadline := time.Now().Add(wait)
+	waiting := false
+	for {
+		err := tryLock(f)
+		if err == nil {
+			break
+		}
+		if err != errLocked {
+			f.Close()
+			return nil, fmt.Errorf("ロックファイル（%s）をロックできません: %v", path, err)
+		}
+		holder, _ := readHolder(path)
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, &LockedError{Holder: holder}
+		}
+		if !waiting {
+			log.Printf("⏳ 他のプロセスの終了を待っています（最大 %v）: %s", wait, holder)
+			waiting = true
+		}
+		time.Sleep(pollInterval)
+	}
+
+	// 持ち主の情報は status の表示や待機中のログに使う
+	host, _ := os.Hostname()
+	data, _ := json.Marshal(Holder{PID: os.Getpid(), Host: host, Command: command, StartedAt: time.Now()})
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt(append(data, '\n'), 0)
+	}
+	if err != nil {
+		log.Printf("⚠️ ロックファイルへの書き込みエラー: %v", err)
+	}
+	return &Lock{file: f}, nil
+}
+
+// Release はロックを解除します（何度呼んでも安全です）
+func (l *Lock) Release() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		// 持ち主の情報を消してから解除する（解除後は次の持ち主が書き込むため触らない）
+		l.file.Truncate(0)
+		if err := unlock(l.file); err != nil {
+			log.Printf("⚠️ ロックの解除エラー: %v", err)
+		}
+		l.file.Close()
+	})
+}
+
+// Status はロックの持ち主を返します（ロックされていなければ nil）
+func Status(path string) (*Holder, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch err := tryLock(f); err {
+	case nil:
+		unlock(f)
+		return nil, nil
+	case errLocked:
+		h, _ := readHolder(path)
+		return &h, nil
+	default:
+		return nil, err
+	}
+}
+
+func readHolder(path string) (Holder, error) {
+	var h Holder
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return h, err
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return h, fmt.Errorf("ロックファイルの解析エラー: %v", err)
+	}
+	return h, nil
+}
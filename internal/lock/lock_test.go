@@ -0,0 +1,67 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestAcquireIsExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.lock")
+
+	// 同時に取りに行っても、取得できるのは1つだけ
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var acquired []*Lock
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := Acquire(path, "run", 0)
+			var locked *LockedError
+			if err != nil && !errors.As(err, &locked) {
+				t.Errorf("Acquire: %v", err)
+			}
+			if l != nil {
+				mu.Lock()
+				acquired = append(acquired, l)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(acquired) != 1 {
+		t.Fatalf("%d goroutines acquired the lock", len(acquired))
+	}
+
+	holder, err := Status(path)
+	if err != nil || holder == nil || holder.PID != os.Getpid() || holder.Command != "run" {
+		t.Fatalf("Status = %+v, %v", holder, err)
+	}
+
+	acquired[0].Release()
+	acquired[0].Release() // 2回目は何もしない
+	if holder, err := Status(path); err != nil || holder != nil {
+		t.Fatalf("Status after release = %+v, %v", holder, err)
+	}
+
+	l, err := Acquire(path, "daemon", 0)
+	if err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+	defer l.Release()
+	if _, err := Acquire(path, "run", 0); err == nil {
+		t.Fatal("second Acquire succeeded while the lock was held")
+	} else if locked, ok := err.(*LockedError); !ok || locked.Holder.Command != "daemon" {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestStatusWithoutLockFile(t *testing.T) {
+	holder, err := Status(filepath.Join(t.TempDir(), "missing.lock"))
+	if err != nil || holder != nil {
+		t.Fatalf("Status = %+v, %v", holder, err)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package lock
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock はファイルの排他ロック（flock）を待たずに取得します（他のプロセスが持っていれば errLocked）
+// ロックはプロセスが終了するとOSが自動で解除します
+func tryLock(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return errLocked
+	}
+	return err
+}
+
+// unlock はファイルの排他ロックを解除します
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
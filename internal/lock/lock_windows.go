@@ -0,0 +1,30 @@
+//go:build windows
+
+package lock
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockOffsetHigh はロックするバイトの位置（上位32ビット）です
+// Windowsのロックは範囲内の読み書きも禁止するため、内容（持ち主の情報）より後ろの1バイトだけをロックします
+const lockOffsetHigh = 1
+
+// tryLock はファイルの排他ロック（LockFileEx）を待たずに取得します（他のプロセスが持っていれば errLocked）
+// ロックはプロセスが終了するとOSが自動で解除します
+func tryLock(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+	if err == windows.ERROR_LOCK_VIOLATION || err == windows.ERROR_IO_PENDING {
+		return errLocked
+	}
+	return err
+}
+
+// unlock はファイルの排他ロックを解除します
+func unlock(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, ol)
+}
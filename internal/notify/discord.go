@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"klms-go/internal/ocr"
+)
+
+const (
+	maxDiscordEmbeds  = 10       // Discordの1メッセージあたりの埋め込み数の上限
+	maxDiscordContent = 2000     // content の文字数の上限
+	discordEmbedColor = 0x1E5AA8 // 埋め込みの色
+	maxDiscordFile    = 8 << 20  // 添付ファイルの上限（8MB）
+)
+
+// DiscordNotifier はDiscordのWebhookに投稿します（スクリーンショットなども添付できます）
+type DiscordNotifier struct {
+	WebhookURL string
+	HTTP       *http.Client
+}
+
+func (n *DiscordNotifier) Name() string { return "discord" }
+
+func (n *DiscordNotifier) Capabilities() Capabilities {
+	return Capabilities{Attachments: true, RichText: true}
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title,omitempty"`
+	Description string         `json:"description,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Color       int            `json:"color,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// Send は課題ごとの埋め込みを組み立て、添付ファイルがあればmultipartで投稿します
+func (n *DiscordNotifier) Send(ctx context.Context, msg Message) error {
+	if n.WebhookURL == "" {
+		return fmt.Errorf("Discord Webhook URLが設定されていません")
+	}
+
+	content := msg.ChatText()
+	if msg.Subject != "" {
+		content = "**" + msg.Subject + "**\n" + content
+	}
+
+	var embeds []discordEmbed
+	for i, a := range msg.Assignments {
+		if i == maxDiscordEmbeds-1 && len(msg.Assignments) > maxDiscordEmbeds {
+			embeds = append(embeds, discordEmbed{Description: fmt.Sprintf("…ほか %d 件", len(msg.Assignments)-i), Color: discordEmbedColor})
+			break
+		}
+		embeds = append(embeds, discordAssignmentEmbed(a))
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"content": truncate(content, maxDiscordContent),
+		"embeds":  embeds,
+	})
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, path := range msg.Attachments {
+		if info, err := os.Stat(path); err == nil && info.Size() <= maxDiscordFile {
+			files = append(files, path)
+		}
+	}
+
+	var req *http.Request
+	if len(files) == 0 {
+		req, err = http.NewRequestWithContext(ctx, "POST", n.WebhookURL, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		body, contentType, err := discordMultipart(payload, files)
+		if err != nil {
+			return err
+		}
+		req, err = http.NewRequestWithContext(ctx, "POST", n.WebhookURL, body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	return doWebhook(n.HTTP, req, "Discord")
+}
+
+func discordAssignmentEmbed(a ocr.Assignment) discordEmbed {
+	embed := discordEmbed{
+		Title: truncate(a.Title, 256),
+		URL:   a.URL,
+		Color: discordEmbedColor,
+		Fields: []discordField{
+			{Name: "科目", Value: truncate(a.Course, 1024), Inline: true},
+			{Name: "期限", Value: ocr.FormatDeadline(a.Deadline), Inline: true},
+		},
+	}
+	if deadline, err := ocr.ParseDeadline(a.Deadline); err == nil {
+		embed.Timestamp = deadline.Format(time.RFC3339)
+	}
+	return embed
+}
+
+// discordMultipart は payload_json と files[n] からなるmultipartの本文を作ります
+func discordMultipart(payload []byte, files []string) (io.Reader, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.WriteField("payload_json", string(payload)); err != nil {
+		return nil, "", err
+	}
+	for i, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("添付ファイル読み込みエラー: %v", err)
+		}
+		part, err := w.CreateFormFile(fmt.Sprintf("files[%d]", i), filepath.Base(path))
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, w.FormDataContentType(), nil
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type discordPayload struct {
+	Content string         `json:"content"`
+	Embeds  []discordEmbed `json:"embeds"`
+}
+
+func TestDiscordPayload(t *testing.T) {
+	srv, c := newCapture(t, http.StatusNoContent, "")
+	n := &DiscordNotifier{WebhookURL: srv.URL}
+	if err := n.Send(context.Background(), testMessage(2)); err != nil {
+		t.Fatal(err)
+	}
+	if c.requests[0].Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Content-Type = %q", c.requests[0].Header.Get("Content-Type"))
+	}
+
+	var payload discordPayload
+	if err := json.Unmarshal(c.bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(payload.Content, "**【K-LMS】課題通知**\n") {
+		t.Errorf("content = %q", payload.Content)
+	}
+	if len(payload.Embeds) != 2 {
+		t.Fatalf("embeds = %d, want 2", len(payload.Embeds))
+	}
+	e := payload.Embeds[0]
+	if e.Title != "課題1 <提出>" || e.URL != "https://lms.keio.jp/courses/1/assignments/1" || e.Timestamp != "2026-01-13T23:59:00+09:00" {
+		t.Errorf("embed = %+v", e)
+	}
+	if len(e.Fields) != 2 || e.Fields[0].Name != "科目" || e.Fields[1].Name != "期限" {
+		t.Errorf("embed fields = %+v", e.Fields)
+	}
+}
+
+func TestDiscordEmbedLimit(t *testing.T) {
+	srv, c := newCapture(t, http.StatusNoContent, "")
+	n := &DiscordNotifier{WebhookURL: srv.URL}
+	if err := n.Send(context.Background(), testMessage(15)); err != nil {
+		t.Fatal(err)
+	}
+	var payload discordPayload
+	json.Unmarshal(c.bodies[0], &payload)
+	if len(payload.Embeds) != maxDiscordEmbeds {
+		t.Fatalf("embeds = %d, want %d", len(payload.Embeds), maxDiscordEmbeds)
+	}
+	if last := payload.Embeds[maxDiscordEmbeds-1]; !strings.Contains(last.Description, "ほか 6 件") {
+		t.Errorf("last embed = %+v", last)
+	}
+}
+
+func TestDiscordAttachments(t *testing.T) {
+	srv, c := newCapture(t, http.StatusOK, "{}")
+	path := filepath.Join(t.TempDir(), "screenshot.png")
+	os.WriteFile(path, []byte("png"), 0644)
+
+	msg := testMessage(1)
+	msg.Attachments = []string{path, filepath.Join(t.TempDir(), "missing.ics")}
+	n := &DiscordNotifier{WebhookURL: srv.URL}
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(c.requests[0].Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("Content-Type = %q", c.requests[0].Header.Get("Content-Type"))
+	}
+	r := multipart.NewReader(strings.NewReader(string(c.bodies[0])), params["boundary"])
+	parts := map[string]string{}
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(p)
+		parts[p.FormName()] = p.FileName() + ":" + string(data)
+	}
+	if len(parts) != 2 || parts["files[0]"] != "screenshot.png:png" {
+		t.Fatalf("parts = %v", parts)
+	}
+	var payload discordPayload
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(parts["payload_json"], ":")), &payload); err != nil || len(payload.Embeds) != 1 {
+		t.Errorf("payload_json = %q (%v)", parts["payload_json"], err)
+	}
+}
+
+func TestDiscordErrorStatus(t *testing.T) {
+	srv, _ := newCapture(t, http.StatusTooManyRequests, `{"message":"You are being rate limited."}`)
+	n := &DiscordNotifier{WebhookURL: srv.URL}
+	err := n.Send(context.Background(), testMessage(1))
+	if err == nil || !strings.Contains(err.Error(), "429") || !strings.Contains(err.Error(), "rate limited") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DryRunNotifier は送信する代わりに、送るはずだった内容を書き出します（--dry-run 用）
+type DryRunNotifier struct {
+	Channel string // 本来のチャネル名
+	Caps    Capabilities
+	Out     io.Writer
+}
+
+func (n *DryRunNotifier) Name() string { return n.Channel }
+
+func (n *DryRunNotifier) Capabilities() Capabilities { return n.Caps }
+
+// Send はメッセージの内容を Out に書き出します
+func (n *DryRunNotifier) Send(ctx context.Context, msg Message) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "===== [dry-run] %s 宛て (%s) =====\n", n.Channel, msg.Event)
+	fmt.Fprintf(&sb, "件名: %s\n\n", msg.Subject)
+	if n.Caps.Attachments {
+		sb.WriteString(msg.Body)
+	} else {
+		sb.WriteString(msg.ChatText())
+	}
+	sb.WriteString("\n")
+	for _, path := range msg.Attachments {
+		if path != "" {
+			fmt.Fprintf(&sb, "📎 %s\n", path)
+		}
+	}
+	sb.WriteString("\n")
+	_, err := io.WriteString(n.Out, sb.String())
+	return err
+}
+
+// DryRun は各チャネルを DryRunNotifier に置き換えたレジストリを返します
+// アウトボックスは使わないため、何も保存されません
+func (r *Registry) DryRun(out io.Writer) *Registry {
+	dry := &Registry{RunID: r.RunID}
+	for _, n := range r.notifiers {
+		dry.Register(&DryRunNotifier{Channel: n.Name(), Caps: n.Capabilities(), Out: out})
+	}
+	return dry
+}
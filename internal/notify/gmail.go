@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/gomail.v2"
+
+	"klms-go/internal/storage"
+)
+
+// GmailDigestMaxEntries はまとめメールに残す保留メッセージの最大件数です（古いものから捨てます）
+const GmailDigestMaxEntries = 50
+
+// GmailNotifier は自分宛てにGmailを送ります（画像や.icsを添付できます）
+// 1日の送信上限（MAX_GMAIL_PER_DAY）の最後の1通には上限到達の案内を付け、
+// それ以降のメッセージは保留して、リセット後に1通のまとめメールとして送ります
+type GmailNotifier struct {
+	User string
+	Pass string // アプリパスワード
+
+	// SendMail はメールを1通送る関数です（nil なら smtp.gmail.com で送る。テストで差し替えます）
+	SendMail func(msg Message) error
+}
+
+func (n *GmailNotifier) Name() string { return "gmail" }
+
+func (n *GmailNotifier) Capabilities() Capabilities { return Capabilities{Attachments: true} }
+
+// Send は画像と.icsファイルを添付してGmailを送ります
+func (n *GmailNotifier) Send(ctx context.Context, msg Message) error {
+	if n.User == "" || n.Pass == "" {
+		return fmt.Errorf("Gmail設定が足りません")
+	}
+
+	status, err := storage.Reserve(storage.QuotaGmail)
+	reserved := true
+	var exceeded *storage.QuotaExceededError
+	if errors.As(err, &exceeded) {
+		if storage.LoadUsage().GmailLimitNotified {
+			// 上限到達後は保留して ErrDeferred を返す（アウトボックスで再送すると上限を超えてしまうため）
+			return deferGmail(msg, exceeded.ResetAt)
+		}
+		// 途中で上限を下げた場合など、上限到達の案内をまだ送っていなければ、上限を超えてもこの1通だけは案内を付けて送る
+		status, reserved = exceeded.QuotaStatus, false
+	} else if err != nil {
+		return err
+	}
+
+	last := status.Remaining() == 0 && !storage.LoadUsage().GmailLimitNotified
+	if last {
+		msg.Body += fmt.Sprintf("\n\n――――――――――\n⚠️ 本日のGmail送信上限（%d通）に達しました。%s までの通知はメールでは送らず、リセット後に1通のまとめメールとして送ります。",
+			status.Limit, status.ResetAt.Format("1月2日 15:04"))
+	}
+
+	if err := n.dial(msg); err != nil {
+		// 送信できなかった分は数えない
+		if reserved {
+			storage.Release(storage.QuotaGmail)
+		}
+		return err
+	}
+	if last {
+		storage.MarkGmailLimitNotified()
+		log.Printf("📪 本日のGmail送信上限（%d通）に達しました。以降のメールは %s まで保留します", status.Limit, status.ResetAt.Format("01/02 15:04"))
+	}
+	return nil
+}
+
+// dial はSMTPでメールを1通送ります
+func (n *GmailNotifier) dial(msg Message) error {
+	if n.SendMail != nil {
+		return n.SendMail(msg)
+	}
+	m := gomail.NewMessage()
+	m.SetHeader("From", n.User)
+	m.SetHeader("To", n.User)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Body)
+
+	// リストにあるファイルを全て添付
+	for _, filePath := range msg.Attachments {
+		if filePath != "" {
+			m.Attach(filePath)
+		}
+	}
+
+	d := gomail.NewDialer("smtp.gmail.com", 587, n.User, n.Pass)
+
+	if err := d.DialAndSend(m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// gmailDigest は上限到達後に保留したメッセージです
+type gmailDigest struct {
+	Period  string        `json:"period"` // 保留した日（使用回数の日付）
+	Entries []digestEntry `json:"entries"`
+}
+
+type digestEntry struct {
+	At          time.Time `json:"at"`
+	Subject     string    `json:"subject"`
+	Text        string    `json:"text"`
+	Attachments []string  `json:"attachments,omitempty"` // ファイル名のみ（まとめメールには添付しません）
+}
+
+func loadGmailDigest() (*gmailDigest, error) {
+	d := &gmailDigest{}
+	if _, err := storage.Load(storage.BucketOutbox, storage.KeyGmailDigest, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// PendingGmail は上限到達で保留しているメッセージの件数を返します
+func PendingGmail() int {
+	d, err := loadGmailDigest()
+	if err != nil {
+		return 0
+	}
+	return len(d.Entries)
+}
+
+// deferGmail はメッセージをまとめメールに追加し、保留したことを表す ErrDeferred を返します
+func deferGmail(msg Message, resetAt time.Time) error {
+	period := storage.LoadUsage().Date
+	err := storage.Update(func(tx storage.Tx) error {
+		d := &gmailDigest{}
+		if _, err := storage.GetJSON(tx, storage.BucketOutbox, storage.KeyGmailDigest, d); err != nil {
+			return err
+		}
+		if len(d.Entries) == 0 {
+			d.Period = period
+		}
+		entry := digestEntry{At: time.Now(), Subject: msg.Subject, Text: msg.ChatText()}
+		for _, path := range msg.Attachments {
+			if path != "" {
+				entry.Attachments = append(entry.Attachments, filepath.Base(path))
+			}
+		}
+		d.Entries = append(d.Entries, entry)
+		if len(d.Entries) > GmailDigestMaxEntries {
+			d.Entries = d.Entries[len(d.Entries)-GmailDigestMaxEntries:]
+		}
+		return storage.PutJSON(tx, storage.BucketOutbox, storage.KeyGmailDigest, d)
+	})
+	if err != nil {
+		return fmt.Errorf("Gmailの保留に失敗しました: %v", err)
+	}
+	return fmt.Errorf("%w（Gmail送信上限のため、%s 以降にまとめて送ります）", ErrDeferred, resetAt.Format("01/02 15:04"))
+}
+
+// FlushPending は上限到達で保留したメッセージを、使用回数のリセット後に1通のまとめメールとして送ります
+func (n *GmailNotifier) FlushPending(ctx context.Context) error {
+	d, err := loadGmailDigest()
+	if err != nil || len(d.Entries) == 0 {
+		return err
+	}
+	if d.Period == storage.LoadUsage().Date {
+		return nil // まだリセットされていない
+	}
+	if _, err := storage.Reserve(storage.QuotaGmail); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "送信上限に達していた間の通知 %d 件をまとめて送ります。\n", len(d.Entries))
+	for _, e := range d.Entries {
+		fmt.Fprintf(&b, "\n==============================\n%s  %s\n\n%s\n", e.At.In(storage.JST).Format("01/02 15:04"), e.Subject, e.Text)
+		if len(e.Attachments) > 0 {
+			fmt.Fprintf(&b, "(添付ファイル %s は省略しました)\n", strings.Join(e.Attachments, ", "))
+		}
+	}
+	msg := Message{
+		Subject: fmt.Sprintf("【K-LMS】保留していた通知のまとめ（%d件）", len(d.Entries)),
+		Body:    b.String(),
+	}
+	if err := n.dial(msg); err != nil {
+		storage.Release(storage.QuotaGmail)
+		return err
+	}
+	log.Printf("📬 保留していた %d 件の通知をまとめてGmailで送りました", len(d.Entries))
+	return storage.Update(func(tx storage.Tx) error {
+		return tx.Delete(storage.BucketOutbox, storage.KeyGmailDigest)
+	})
+}
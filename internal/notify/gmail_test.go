@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"klms-go/internal/storage"
+)
+
+// newTestGmail は送ったメールを記録するGmailNotifierと、空のデータベースを用意します
+func newTestGmail(t *testing.T, limit int) (*GmailNotifier, *[]Message) {
+	t.Helper()
+	s, err := storage.Open(filepath.Join(t.TempDir(), "klms.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.SetDefault(s)
+	storage.ConfigureQuotas(storage.QuotaConfig{Limits: map[storage.Quota]int{storage.QuotaGmail: limit}})
+	t.Cleanup(func() { storage.ConfigureQuotas(storage.DefaultQuotaConfig) })
+
+	var sent []Message
+	n := &GmailNotifier{User: "me@example.com", Pass: "app-password", SendMail: func(msg Message) error {
+		sent = append(sent, msg)
+		return nil
+	}}
+	return n, &sent
+}
+
+// send は n 通のメッセージを送り、保留された件数を返します
+func send(t *testing.T, g *GmailNotifier, n int) int {
+	t.Helper()
+	deferred := 0
+	for i := 0; i < n; i++ {
+		err := g.Send(context.Background(), Message{Subject: fmt.Sprintf("通知 %d", i), Body: "本文"})
+		switch {
+		case errors.Is(err, ErrDeferred):
+			deferred++
+		case err != nil:
+			t.Fatal(err)
+		}
+	}
+	return deferred
+}
+
+// limitNotices は上限到達の案内が付いたメールの数です
+func limitNotices(sent []Message) int {
+	count := 0
+	for _, msg := range sent {
+		if strings.Contains(msg.Body, "本日のGmail送信上限") {
+			count++
+		}
+	}
+	return count
+}
+
+func TestGmailLimitNoticeOncePerDay(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		before   int // 上限を変える前に送る数
+		lowered  int // 途中で下げた上限（0 なら変えない）
+		after    int
+		wantSent int
+	}{
+		{name: "上限ちょうどで案内する", limit: 3, after: 5, wantSent: 3},
+		{name: "上限が1通", limit: 1, after: 3, wantSent: 1},
+		// 送信済みの数より上限を下げると Reserve が最初から失敗するが、案内は1通だけ送る
+		{name: "途中で上限を下げた", limit: 5, before: 2, lowered: 1, after: 3, wantSent: 3},
+		{name: "途中で送信済みの数と同じ上限に下げた", limit: 5, before: 2, lowered: 2, after: 3, wantSent: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, sent := newTestGmail(t, tt.limit)
+			deferred := send(t, g, tt.before)
+			if tt.lowered > 0 {
+				storage.ConfigureQuotas(storage.QuotaConfig{Limits: map[storage.Quota]int{storage.QuotaGmail: tt.lowered}})
+			}
+			deferred += send(t, g, tt.after)
+
+			if got := limitNotices(*sent); got != 1 {
+				t.Errorf("上限到達の案内: %d 通", got)
+			}
+			if len(*sent) != tt.wantSent {
+				t.Errorf("送ったメール: %d 通, want %d", len(*sent), tt.wantSent)
+			}
+			if want := tt.before + tt.after - tt.wantSent; deferred != want || PendingGmail() != want {
+				t.Errorf("保留: %d 件（まとめメールに %d 件）, want %d", deferred, PendingGmail(), want)
+			}
+			if !storage.LoadUsage().GmailLimitNotified {
+				t.Error("案内を送ったことが記録されていません")
+			}
+		})
+	}
+}
+
+func TestGmailLimitNoticeRetriedAfterSendFailure(t *testing.T) {
+	g, sent := newTestGmail(t, 1)
+	record := g.SendMail
+	g.SendMail = func(msg Message) error { return errors.New("SMTPに接続できません") }
+	if err := g.Send(context.Background(), Message{Subject: "通知", Body: "本文"}); err == nil || errors.Is(err, ErrDeferred) {
+		t.Fatalf("送信の失敗が返されていません: %v", err)
+	}
+	if storage.LoadUsage().GmailLimitNotified {
+		t.Error("送れなかった案内が送信済みになっています")
+	}
+
+	// 送れなかった分は数えないので、再送で案内を送る
+	g.SendMail = record
+	if deferred := send(t, g, 2); deferred != 1 {
+		t.Errorf("保留: %d 件", deferred)
+	}
+	if got := limitNotices(*sent); got != 1 || len(*sent) != 1 {
+		t.Errorf("送ったメール: %d 通（案内 %d 通）", len(*sent), got)
+	}
+}
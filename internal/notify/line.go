@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"klms-go/internal/storage"
+)
+
+// LINENotifier はLINE Messaging APIでプッシュメッセージを送ります
+type LINENotifier struct {
+	Token  string
+	UserID string
+}
+
+func (n *LINENotifier) Name() string { return "line" }
+
+func (n *LINENotifier) Capabilities() Capabilities { return Capabilities{} }
+
+// Send はテキストメッセージをLINEに送ります
+func (n *LINENotifier) Send(ctx context.Context, msg Message) (err error) {
+	if n.Token == "" || n.UserID == "" {
+		return fmt.Errorf("LINE設定が足りません")
+	}
+
+	if _, err := storage.Reserve(storage.QuotaLine); err != nil {
+		return err
+	}
+	defer func() {
+		// 送信できなかった分は数えない
+		if err != nil {
+			storage.Release(storage.QuotaLine)
+		}
+	}()
+
+	text := msg.ChatText()
+	if msg.Subject != "" {
+		text = msg.Subject + "\n\n" + text
+	}
+
+	payload := map[string]interface{}{
+		"to": n.UserID,
+		"messages": []map[string]string{
+			{"type": "text", "text": text},
+		},
+	}
+
+	jsonData, _ := json.Marshal(payload)
+	req, _ := http.NewRequestWithContext(ctx, "POST", "https://api.line.me/v2/bot/message/push", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+n.Token)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("LINE送信失敗: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -1,89 +1,250 @@
 package notify
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"os"
-
-	"gopkg.in/gomail.v2"
-	
-	"klms-go/internal/storage"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"klms-go/internal/config"
+	"klms-go/internal/diff"
+	"klms-go/internal/ocr"
 )
 
+// イベント種別（Webhookのペイロードに含まれます）
 const (
-	MaxLinePerDay  = 10
-	MaxGmailPerDay = 50
+	EventAssignmentsChanged = "assignments.changed" // 課題の追加・変更
+	EventReminder           = "reminder.due"        // 締切リマインダー
+	EventError              = "error"               // エラー・警告
 )
 
-// SendLINE はテキストメッセージをLINEに送ります
-func SendLINE(message string) error {
-	usage := storage.LoadUsage()
-	if usage.LineCount >= MaxLinePerDay {
-		return fmt.Errorf("本日のLINE送信上限(%d回)に達したためスキップします", MaxLinePerDay)
+// Message は全チャネルに共通の通知内容です
+// 各チャネルは自分の機能（Capabilities）に合わせて表示を組み立てます
+type Message struct {
+	Event       string           `json:"event"`                 // イベント種別（EventAssignmentsChanged など）
+	RunID       string           `json:"run_id"`                // 実行ID（空ならレジストリの RunID を使う）
+	Subject     string           `json:"subject"`               // 件名（チャットでは見出し）
+	Body        string           `json:"body"`                  // 本文（メールなど詳細向け）
+	Summary     string           `json:"summary,omitempty"`     // チャット向けの短い本文（空なら Body を使う）
+	Attachments []string         `json:"attachments,omitempty"` // 添付ファイルのパス
+	Assignments []ocr.Assignment `json:"assignments,omitempty"` // 関連する課題（リッチ表示に使う。任意）
+	Changes     []diff.Change    `json:"changes,omitempty"`     // 前回からの差分（任意）
+}
+
+// ChatText はチャット向けの本文を返します
+func (m Message) ChatText() string {
+	if m.Summary != "" {
+		return m.Summary
 	}
+	return m.Body
+}
 
-	token := os.Getenv("LINE_TOKEN")
-	userID := os.Getenv("LINE_USER_ID")
+// Capabilities はチャネルが対応している表現です
+type Capabilities struct {
+	Attachments bool // ファイル添付ができる
+	RichText    bool // ブロック・埋め込みなどのリッチ表示ができる
+}
 
-	if token == "" || userID == "" {
-		return fmt.Errorf("LINE設定が足りません")
-	}
+// Notifier は通知チャネルです
+type Notifier interface {
+	Name() string
+	Capabilities() Capabilities
+	Send(ctx context.Context, msg Message) error
+}
 
-	payload := map[string]interface{}{
-		"to": userID,
-		"messages": []map[string]string{
-			{"type": "text", "text": message},
-		},
-	}
+// PendingFlusher は送信を保留したメッセージを持つチャネルです（上限到達後のGmailなど）
+// Flush のたびに FlushPending が呼ばれ、送れるようになっていれば送ります
+type PendingFlusher interface {
+	FlushPending(ctx context.Context) error
+}
 
-	jsonData, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", "https://api.line.me/v2/bot/message/push", bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
+// ErrDeferred は送信せずに保留したことを表します（上限到達後のGmailなど）
+// 保留したメッセージはチャネル自身が後で送るため、アウトボックスでは再送しません
+var ErrDeferred = errors.New("送信を保留しました")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// Result はチャネルごとの送信結果です
+type Result struct {
+	Channel string
+	Err     error
+}
+
+// Deferred は送信せずに保留したかを返します
+func (r Result) Deferred() bool {
+	return errors.Is(r.Err, ErrDeferred)
+}
+
+// Registry は有効な通知チャネルの一覧です
+type Registry struct {
+	RunID string // この実行のID（各メッセージに設定されます）
+
+	// Outbox を設定すると、送信前にメッセージを保存し、失敗した分は次回以降に再送します
+	Outbox *Outbox
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("LINE送信失敗: %s", resp.Status)
+	notifiers []Notifier
+}
+
+// NewRegistry は設定されているチャネルを登録したレジストリを作成します
+// チャネルを追加する場合はここに登録します
+func NewRegistry(cfg *config.Config) *Registry {
+	r := &Registry{}
+	if cfg == nil {
+		return r
+	}
+	if cfg.LineToken != "" && cfg.LineUserID != "" {
+		r.Register(&LINENotifier{Token: cfg.LineToken, UserID: cfg.LineUserID})
+	}
+	if cfg.SMTPUser != "" && cfg.SMTPPass != "" {
+		r.Register(&GmailNotifier{User: cfg.SMTPUser, Pass: cfg.SMTPPass})
+	}
+	if cfg.SlackWebhookURL != "" {
+		r.Register(&SlackNotifier{WebhookURL: cfg.SlackWebhookURL})
+	}
+	if cfg.DiscordWebhookURL != "" {
+		r.Register(&DiscordNotifier{WebhookURL: cfg.DiscordWebhookURL})
+	}
+	if cfg.WebhookURL != "" {
+		r.Register(&WebhookNotifier{URL: cfg.WebhookURL, Secret: cfg.WebhookSecret})
 	}
+	return r
+}
+
+// Register はチャネルを追加します
+func (r *Registry) Register(n Notifier) {
+	r.notifiers = append(r.notifiers, n)
+}
 
-	storage.IncrementLine()
+// Notifiers は登録されているチャネルを返します
+func (r *Registry) Notifiers() []Notifier {
+	return r.notifiers
+}
+
+// Get は名前でチャネルを探します（なければnil）
+func (r *Registry) Get(name string) Notifier {
+	for _, n := range r.notifiers {
+		if n.Name() == name {
+			return n
+		}
+	}
 	return nil
 }
 
-// SendGmail は画像と.icsファイルを添付してGmailを送ります
-func SendGmail(subject string, body string, attachments []string) error {
-	smtpUser := os.Getenv("SMTP_USER")
-	smtpPass := os.Getenv("SMTP_PASS")
+// Only は指定した名前のチャネルだけを含むレジストリを返します
+func (r *Registry) Only(names ...string) *Registry {
+	sub := &Registry{RunID: r.RunID, Outbox: r.Outbox}
+	for _, name := range names {
+		if n := r.Get(name); n != nil {
+			sub.Register(n)
+		}
+	}
+	return sub
+}
+
+// Send はすべてのチャネルにメッセージを送り、チャネルごとの結果を返します
+// 1つのチャネルの失敗は他のチャネルに影響しません
+// Outbox が設定されている場合、失敗したメッセージは次回以降の Flush で再送されます
+func (r *Registry) Send(ctx context.Context, msg Message) []Result {
+	if len(r.notifiers) == 0 {
+		log.Println("⚠️ 有効な通知チャネルがありません")
+		return nil
+	}
+	if msg.RunID == "" {
+		msg.RunID = r.RunID
+	}
+	if r.Outbox == nil {
+		results := make([]Result, 0, len(r.notifiers))
+		for _, n := range r.notifiers {
+			results = append(results, Result{Channel: n.Name(), Err: deliver(ctx, n, msg)})
+		}
+		return results
+	}
 
-	if smtpUser == "" || smtpPass == "" {
-		return fmt.Errorf("Gmail設定が足りません")
+	// 先にキューへ保存してから送る（途中で落ちても次回に再送される）
+	now := time.Now()
+	entries := make([]*OutboxEntry, 0, len(r.notifiers))
+	for _, n := range r.notifiers {
+		entry, err := r.Outbox.Enqueue(n.Name(), msg, now)
+		if err != nil {
+			log.Printf("⚠️ アウトボックスへの保存に失敗しました（%s）: %v", n.Name(), err)
+			entry = &OutboxEntry{Channel: n.Name(), Message: msg}
+		}
+		entries = append(entries, entry)
 	}
+	if err := r.Outbox.Save(); err != nil {
+		log.Printf("⚠️ アウトボックスの保存に失敗しました: %v", err)
+	}
+
+	results := make([]Result, 0, len(entries))
+	for _, entry := range entries {
+		results = append(results, Result{Channel: entry.Channel, Err: r.deliverEntry(ctx, entry, now)})
+	}
+	if err := r.Outbox.Save(); err != nil {
+		log.Printf("⚠️ アウトボックスの保存に失敗しました: %v", err)
+	}
+	return results
+}
 
-	m := gomail.NewMessage()
-	m.SetHeader("From", smtpUser)
-	m.SetHeader("To", smtpUser)
-	m.SetHeader("Subject", subject)
-	m.SetBody("text/plain", body)
+// Flush は以前の実行で送れなかったメッセージのうち、再送時刻を過ぎたものを送ります
+func (r *Registry) Flush(ctx context.Context) []Result {
+	for _, n := range r.notifiers {
+		if f, ok := n.(PendingFlusher); ok {
+			if err := f.FlushPending(ctx); err != nil {
+				log.Printf("⚠️ %s の保留中のメッセージの送信エラー: %v", n.Name(), err)
+			}
+		}
+	}
+	if r.Outbox == nil {
+		return nil
+	}
+	now := time.Now()
+	r.Outbox.Expire(now)
 
-	// リストにあるファイルを全て添付
-	for _, filePath := range attachments {
-		if filePath != "" {
-			m.Attach(filePath)
+	var results []Result
+	for _, entry := range r.Outbox.Due(now) {
+		if r.Get(entry.Channel) == nil {
+			continue // 現在は無効なチャネル（期限切れまで保持する）
 		}
+		log.Printf("📮 未送信のメッセージを再送します（%s, %d回目）: %s", entry.Channel, entry.Attempts+1, entry.Message.Subject)
+		results = append(results, Result{Channel: entry.Channel, Err: r.deliverEntry(ctx, entry, now)})
+	}
+	if err := r.Outbox.Save(); err != nil {
+		log.Printf("⚠️ アウトボックスの保存に失敗しました: %v", err)
+	}
+	return results
+}
+
+// deliverEntry はキューのメッセージを1件送り、結果をアウトボックスに反映します
+func (r *Registry) deliverEntry(ctx context.Context, entry *OutboxEntry, now time.Time) error {
+	err := deliver(ctx, r.Get(entry.Channel), entry.Message)
+	if entry.ID == "" {
+		return err // キューに保存できなかったメッセージ
 	}
+	if err != nil && !errors.Is(err, ErrDeferred) {
+		r.Outbox.MarkFailed(entry, err, now)
+	} else {
+		r.Outbox.MarkDelivered(entry)
+	}
+	return err
+}
 
-	d := gomail.NewDialer("smtp.gmail.com", 587, smtpUser, smtpPass)
+func deliver(ctx context.Context, n Notifier, msg Message) error {
+	log.Printf("📨 %s 送信中...", n.Name())
+	err := n.Send(ctx, msg)
+	if errors.Is(err, ErrDeferred) {
+		log.Printf("📪 %s: %v", n.Name(), err)
+	} else if err != nil {
+		log.Printf("⚠️ %s 送信エラー: %v", n.Name(), err)
+	} else {
+		log.Printf("✅ %s 送信完了", n.Name())
+	}
+	return err
+}
 
-	if err := d.DialAndSend(m); err != nil {
-		return err
+// AnySucceeded はいずれかのチャネルで送信に成功したか、保留して後で送ることになったかを返します
+func AnySucceeded(results []Result) bool {
+	for _, r := range results {
+		if r.Err == nil || r.Deferred() {
+			return true
+		}
 	}
-	return nil
-}
\ No newline at end of file
+	return false
+}
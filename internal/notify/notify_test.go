@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeNotifier は決まったエラーを返すチャネルです
+type fakeNotifier struct {
+	name string
+	err  error
+	sent int
+}
+
+func (f *fakeNotifier) Name() string               { return f.name }
+func (f *fakeNotifier) Capabilities() Capabilities { return Capabilities{} }
+func (f *fakeNotifier) Send(ctx context.Context, msg Message) error {
+	f.sent++
+	return f.err
+}
+
+func TestSendReportsDeferredSeparately(t *testing.T) {
+	deferred := fmt.Errorf("%w（テスト）", ErrDeferred)
+	r := &Registry{}
+	r.Register(&fakeNotifier{name: "gmail", err: deferred})
+	r.Register(&fakeNotifier{name: "slack", err: errors.New("HTTP 500")})
+
+	results := r.Send(context.Background(), testMessage(1))
+	if len(results) != 2 {
+		t.Fatalf("結果の数: %d", len(results))
+	}
+	if !results[0].Deferred() || results[0].Err == nil {
+		t.Errorf("gmail が保留として報告されていません: %+v", results[0])
+	}
+	if results[1].Deferred() {
+		t.Errorf("送信エラーが保留として扱われています: %+v", results[1])
+	}
+	if !AnySucceeded(results) {
+		t.Error("保留したチャネルがあるのに AnySucceeded が false です")
+	}
+	if AnySucceeded(results[1:]) {
+		t.Error("失敗だけなのに AnySucceeded が true です")
+	}
+}
+
+func TestDeferredIsNotRetriedFromOutbox(t *testing.T) {
+	now := time.Now()
+	deferredEntry := &OutboxEntry{ID: "deferred", Channel: "gmail", Message: testMessage(1), CreatedAt: now}
+	failedEntry := &OutboxEntry{ID: "failed", Channel: "slack", Message: testMessage(1), CreatedAt: now}
+	r := &Registry{Outbox: &Outbox{Dir: t.TempDir(), Entries: []*OutboxEntry{deferredEntry, failedEntry}}}
+	r.Register(&fakeNotifier{name: "gmail", err: ErrDeferred})
+	r.Register(&fakeNotifier{name: "slack", err: errors.New("HTTP 500")})
+
+	if err := r.deliverEntry(context.Background(), deferredEntry, now); !errors.Is(err, ErrDeferred) {
+		t.Errorf("保留のエラーが返されていません: %v", err)
+	}
+	r.deliverEntry(context.Background(), failedEntry, now)
+
+	if len(r.Outbox.Entries) != 1 || r.Outbox.Entries[0] != failedEntry {
+		t.Fatalf("保留したメッセージがアウトボックスに残っています: %+v", r.Outbox.Entries)
+	}
+	if failedEntry.Attempts != 1 {
+		t.Errorf("失敗したメッセージの試行回数: %d", failedEntry.Attempts)
+	}
+}
@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"klms-go/internal/storage"
+)
+
+// アウトボックス（未送信メッセージのキュー）の設定
+const (
+	OutboxDir            = "data/outbox" // 添付ファイルのコピー先
+	OutboxMaxAttempts    = 10
+	OutboxInitialBackoff = 1 * time.Minute
+	OutboxMaxBackoff     = 6 * time.Hour
+	OutboxMaxAge         = 72 * time.Hour // これより古い未送信メッセージは破棄する
+)
+
+// OutboxEntry はチャネルごとの送信待ちメッセージです
+type OutboxEntry struct {
+	ID            string    `json:"id"`
+	Channel       string    `json:"channel"`
+	Message       Message   `json:"message"`
+	Attempts      int       `json:"attempts"`
+	CreatedAt     time.Time `json:"created_at"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// Outbox は送信待ちメッセージをデータベースに保存し、実行をまたいで再送します
+type Outbox struct {
+	Dir     string         `json:"-"`
+	Entries []*OutboxEntry `json:"entries"`
+}
+
+// LoadOutbox はアウトボックスを読み込みます（なければ空）
+func LoadOutbox(dir string) (*Outbox, error) {
+	o := &Outbox{Dir: dir}
+	if _, err := storage.Load(storage.BucketOutbox, storage.KeyOutbox, o); err != nil {
+		return nil, fmt.Errorf("アウトボックス解析エラー: %v", err)
+	}
+	return o, nil
+}
+
+// Save はアウトボックスを保存します
+func (o *Outbox) Save() error {
+	return storage.Save(storage.BucketOutbox, storage.KeyOutbox, o)
+}
+
+// Enqueue はメッセージをチャネル宛てにキューへ追加します
+// 添付ファイルは次回の実行で上書きされないようアウトボックス内にコピーします
+func (o *Outbox) Enqueue(channel string, msg Message, now time.Time) (*OutboxEntry, error) {
+	id := newOutboxID(now)
+	if len(msg.Attachments) > 0 {
+		dir := filepath.Join(o.Dir, id)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		copied := make([]string, 0, len(msg.Attachments))
+		for _, path := range msg.Attachments {
+			if path == "" {
+				continue
+			}
+			dst := filepath.Join(dir, filepath.Base(path))
+			if err := copyFile(path, dst); err != nil {
+				log.Printf("⚠️ 添付ファイルのコピーに失敗しました（添付せずに送信します）: %v", err)
+				continue
+			}
+			copied = append(copied, dst)
+		}
+		msg.Attachments = copied
+	}
+
+	entry := &OutboxEntry{
+		ID:            id,
+		Channel:       channel,
+		Message:       msg,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+	o.Entries = append(o.Entries, entry)
+	return entry, nil
+}
+
+// Due は今送るべきメッセージを返します
+func (o *Outbox) Due(now time.Time) []*OutboxEntry {
+	var due []*OutboxEntry
+	for _, e := range o.Entries {
+		if !now.Before(e.NextAttemptAt) {
+			due = append(due, e)
+		}
+	}
+	return due
+}
+
+// MarkDelivered は送信できたメッセージをキューから削除します
+func (o *Outbox) MarkDelivered(entry *OutboxEntry) {
+	o.remove(entry)
+}
+
+// MarkFailed は送信失敗を記録し、次回の送信時刻を指数バックオフで決めます
+// 試行回数の上限を超えたメッセージは破棄します
+func (o *Outbox) MarkFailed(entry *OutboxEntry, err error, now time.Time) {
+	entry.Attempts++
+	entry.LastError = err.Error()
+	if entry.Attempts >= OutboxMaxAttempts {
+		log.Printf("❌ %s 宛てのメッセージ「%s」は %d 回失敗したため破棄します: %v", entry.Channel, entry.Message.Subject, entry.Attempts, err)
+		o.remove(entry)
+		return
+	}
+	backoff := OutboxInitialBackoff << uint(entry.Attempts-1)
+	if backoff > OutboxMaxBackoff || backoff <= 0 {
+		backoff = OutboxMaxBackoff
+	}
+	entry.NextAttemptAt = now.Add(backoff)
+}
+
+// Expire は古すぎる未送信メッセージを破棄します
+func (o *Outbox) Expire(now time.Time) {
+	for _, e := range append([]*OutboxEntry(nil), o.Entries...) {
+		if now.Sub(e.CreatedAt) > OutboxMaxAge {
+			log.Printf("🗑️ %s 宛てのメッセージ「%s」は送信できないまま期限切れになったため破棄します（最後のエラー: %s）", e.Channel, e.Message.Subject, e.LastError)
+			o.remove(e)
+		}
+	}
+}
+
+func (o *Outbox) remove(entry *OutboxEntry) {
+	for i, e := range o.Entries {
+		if e == entry {
+			o.Entries = append(o.Entries[:i], o.Entries[i+1:]...)
+			break
+		}
+	}
+	if entry.ID != "" {
+		os.RemoveAll(filepath.Join(o.Dir, entry.ID))
+	}
+}
+
+func newOutboxID(now time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return now.Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
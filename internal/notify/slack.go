@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"klms-go/internal/ocr"
+)
+
+// 1メッセージに表示する課題の上限
+// Slackは1メッセージ50ブロックまでで、課題1件につき区切り線と本文の2ブロックを使う
+const maxSlackAssignmentBlocks = 20
+
+// SlackNotifier はSlackのIncoming Webhookに投稿します
+// Incoming Webhookはファイルを添付できないため、スクリーンショットは送りません
+type SlackNotifier struct {
+	WebhookURL string
+	HTTP       *http.Client
+}
+
+func (n *SlackNotifier) Name() string { return "slack" }
+
+func (n *SlackNotifier) Capabilities() Capabilities { return Capabilities{RichText: true} }
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+// Send は課題ごとのブロックを組み立てて投稿します
+func (n *SlackNotifier) Send(ctx context.Context, msg Message) error {
+	if n.WebhookURL == "" {
+		return fmt.Errorf("Slack Webhook URLが設定されていません")
+	}
+
+	var blocks []slackBlock
+	if msg.Subject != "" {
+		blocks = append(blocks, slackBlock{Type: "header", Text: &slackText{Type: "plain_text", Text: truncate(msg.Subject, 150)}})
+	}
+	blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncate(slackEscape(msg.ChatText()), 3000)}})
+	for i, a := range msg.Assignments {
+		if i == maxSlackAssignmentBlocks {
+			blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: fmt.Sprintf("…ほか %d 件", len(msg.Assignments)-i)}})
+			break
+		}
+		blocks = append(blocks, slackBlock{Type: "divider"}, slackAssignmentBlock(a))
+	}
+
+	payload := map[string]interface{}{
+		"text":   msg.Subject + "\n" + msg.ChatText(), // 通知のプレビュー用
+		"blocks": blocks,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doWebhook(n.HTTP, req, "Slack")
+}
+
+func slackAssignmentBlock(a ocr.Assignment) slackBlock {
+	title := slackEscape(a.Title)
+	if a.URL != "" {
+		title = fmt.Sprintf("<%s|%s>", a.URL, title)
+	}
+	return slackBlock{
+		Type: "section",
+		Text: &slackText{Type: "mrkdwn", Text: "*" + title + "*"},
+		Fields: []slackText{
+			{Type: "mrkdwn", Text: "*科目*\n" + slackEscape(a.Course)},
+			{Type: "mrkdwn", Text: "*期限*\n" + ocr.FormatDeadline(a.Deadline)},
+		},
+	}
+}
+
+// slackEscape はSlackのmrkdwnで特別な意味を持つ文字をエスケープします
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// truncate は文字数（rune数）の上限を超えた文字列を切り詰めます
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
+
+// doWebhook はWebhookへのリクエストを送り、2xx以外をエラーにします
+func doWebhook(client *http.Client, req *http.Request, service string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s送信失敗: %s %s", service, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"klms-go/internal/ocr"
+)
+
+// capture は受け取ったリクエストを記録し、status を返すテスト用のWebhookです
+type capture struct {
+	requests []*http.Request
+	bodies   [][]byte
+
+	// statuses を設定すると、n 回目のリクエストに statuses[n-1] を返します（足りない分は最後の値）
+	statuses []int
+}
+
+func newCapture(t *testing.T, status int, reply string) (*httptest.Server, *capture) {
+	t.Helper()
+	c := &capture{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		c.requests = append(c.requests, r)
+		c.bodies = append(c.bodies, body)
+		if len(c.statuses) > 0 {
+			w.WriteHeader(c.statuses[min(len(c.requests), len(c.statuses))-1])
+		} else {
+			w.WriteHeader(status)
+		}
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, c
+}
+
+func testMessage(n int) Message {
+	msg := Message{Event: EventAssignmentsChanged, Subject: "【K-LMS】課題通知", Body: "本文", Summary: "🆕 新しい課題 <b> & more"}
+	for i := 0; i < n; i++ {
+		msg.Assignments = append(msg.Assignments, ocr.Assignment{
+			Course:   "統計学基礎 (藪 友良)",
+			Title:    fmt.Sprintf("課題%d <提出>", i+1),
+			Deadline: "2026-01-13 23:59",
+			URL:      fmt.Sprintf("https://lms.keio.jp/courses/1/assignments/%d", i+1),
+		})
+	}
+	return msg
+}
+
+func TestSlackPayload(t *testing.T) {
+	srv, c := newCapture(t, http.StatusOK, "ok")
+	n := &SlackNotifier{WebhookURL: srv.URL}
+	if err := n.Send(context.Background(), testMessage(2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.requests) != 1 || c.requests[0].Method != "POST" || c.requests[0].Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected request: %+v", c.requests)
+	}
+
+	var payload struct {
+		Text   string       `json:"text"`
+		Blocks []slackBlock `json:"blocks"`
+	}
+	if err := json.Unmarshal(c.bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(payload.Text, "【K-LMS】課題通知") {
+		t.Errorf("text = %q", payload.Text)
+	}
+	// header, summary, (divider, assignment) x 2
+	if len(payload.Blocks) != 6 {
+		t.Fatalf("blocks = %d, want 6: %s", len(payload.Blocks), c.bodies[0])
+	}
+	if payload.Blocks[0].Type != "header" || payload.Blocks[0].Text.Text != "【K-LMS】課題通知" {
+		t.Errorf("header block = %+v", payload.Blocks[0])
+	}
+	if got := payload.Blocks[1].Text.Text; got != "🆕 新しい課題 &lt;b&gt; &amp; more" {
+		t.Errorf("summary is not escaped: %q", got)
+	}
+	a := payload.Blocks[3]
+	if a.Type != "section" || a.Text.Text != "*<https://lms.keio.jp/courses/1/assignments/1|課題1 &lt;提出&gt;>*" {
+		t.Errorf("assignment block = %+v", a)
+	}
+	if len(a.Fields) != 2 || !strings.Contains(a.Fields[0].Text, "統計学基礎") || !strings.Contains(a.Fields[1].Text, "23:59") {
+		t.Errorf("assignment fields = %+v", a.Fields)
+	}
+}
+
+func TestSlackBlockLimit(t *testing.T) {
+	srv, c := newCapture(t, http.StatusOK, "ok")
+	n := &SlackNotifier{WebhookURL: srv.URL}
+	if err := n.Send(context.Background(), testMessage(30)); err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		Blocks []slackBlock `json:"blocks"`
+	}
+	json.Unmarshal(c.bodies[0], &payload)
+	if len(payload.Blocks) > 50 {
+		t.Fatalf("blocks = %d, Slack allows at most 50", len(payload.Blocks))
+	}
+	if last := payload.Blocks[len(payload.Blocks)-1]; !strings.Contains(last.Text.Text, "ほか 10 件") {
+		t.Errorf("last block = %+v", last)
+	}
+}
+
+func TestSlackErrorStatus(t *testing.T) {
+	srv, _ := newCapture(t, http.StatusBadRequest, "invalid_blocks")
+	n := &SlackNotifier{WebhookURL: srv.URL}
+	err := n.Send(context.Background(), testMessage(1))
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "invalid_blocks") {
+		t.Fatalf("err = %v", err)
+	}
+	if err := (&SlackNotifier{}).Send(context.Background(), testMessage(1)); err == nil {
+		t.Error("Send without a webhook URL succeeded")
+	}
+}
@@ -0,0 +1,177 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"klms-go/internal/diff"
+	"klms-go/internal/ocr"
+)
+
+// WebhookPayloadVersion はペイロードの形式のバージョンです
+// 互換性のない変更をする場合に上げます
+const WebhookPayloadVersion = 1
+
+// 再送の設定
+const (
+	WebhookMaxAttempts  = 4               // 最大試行回数（初回を含む）
+	WebhookInitialDelay = 2 * time.Second // 初回の再送までの待ち時間（以降2倍ずつ）
+	WebhookTimeout      = 15 * time.Second
+)
+
+// 署名などのHTTPヘッダー
+const (
+	HeaderSignature = "X-KLMS-Signature" // "sha256=" + HMAC-SHA256(secret, timestamp + "." + body)
+	HeaderTimestamp = "X-KLMS-Timestamp" // 署名したUNIX時刻（秒）
+	HeaderEvent     = "X-KLMS-Event"
+	HeaderRunID     = "X-KLMS-Run-ID"
+)
+
+// WebhookNotifier は任意のURLに署名付きのJSONをPOSTします
+// Home Assistantや自作のボットなどとの連携用です
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	HTTP   *http.Client
+
+	// RetryDelay は初回の再送までの待ち時間です（0なら WebhookInitialDelay）
+	RetryDelay time.Duration
+}
+
+// WebhookPayload は送信するJSONの形式です
+type WebhookPayload struct {
+	Version     int              `json:"version"`
+	Event       string           `json:"event"`
+	RunID       string           `json:"run_id"`
+	SentAt      string           `json:"sent_at"`
+	Subject     string           `json:"subject"`
+	Text        string           `json:"text"`
+	Assignments []ocr.Assignment `json:"assignments"`
+	Changes     []diff.Change    `json:"changes"`
+	Screenshot  string           `json:"screenshot,omitempty"` // スクリーンショットのパス
+	Attachments []string         `json:"attachments,omitempty"`
+}
+
+func (n *WebhookNotifier) Name() string { return "webhook" }
+
+func (n *WebhookNotifier) Capabilities() Capabilities { return Capabilities{RichText: true} }
+
+// Send はペイロードをPOSTします。5xxや通信エラーの場合はバックオフしながら再送します
+func (n *WebhookNotifier) Send(ctx context.Context, msg Message) error {
+	if n.URL == "" {
+		return fmt.Errorf("Webhook URLが設定されていません")
+	}
+
+	payload := WebhookPayload{
+		Version:     WebhookPayloadVersion,
+		Event:       msg.Event,
+		RunID:       msg.RunID,
+		SentAt:      time.Now().Format(time.RFC3339),
+		Subject:     msg.Subject,
+		Text:        msg.Body,
+		Assignments: msg.Assignments,
+		Changes:     msg.Changes,
+		Attachments: msg.Attachments,
+	}
+	if payload.Assignments == nil {
+		payload.Assignments = []ocr.Assignment{}
+	}
+	if payload.Changes == nil {
+		payload.Changes = []diff.Change{}
+	}
+	for _, path := range msg.Attachments {
+		if strings.EqualFold(filepath.Ext(path), ".png") {
+			payload.Screenshot = path
+			break
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := n.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: WebhookTimeout}
+	}
+
+	delay := n.RetryDelay
+	if delay <= 0 {
+		delay = WebhookInitialDelay
+	}
+	var lastErr error
+	for attempt := 1; attempt <= WebhookMaxAttempts; attempt++ {
+		if attempt > 1 {
+			log.Printf("🔄 Webhook再送 %d/%d 回目（%v 待機後）", attempt, WebhookMaxAttempts, delay)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		retry, err := n.post(ctx, client, msg, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			return err
+		}
+	}
+	return fmt.Errorf("Webhook送信失敗（%d回試行）: %v", WebhookMaxAttempts, lastErr)
+}
+
+// post は1回送信し、失敗した場合は再送すべきかを返します
+func (n *WebhookNotifier) post(ctx context.Context, client *http.Client, msg Message, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", n.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderEvent, msg.Event)
+	req.Header.Set(HeaderRunID, msg.RunID)
+	if n.Secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(n.Secret, timestamp, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("Webhookサーバーエラー: %s", resp.Status)
+	}
+	return false, fmt.Errorf("Webhook送信失敗: %s", resp.Status)
+}
+
+// Sign はWebhookの署名（HMAC-SHA256の16進数）を計算します
+// 受信側は X-KLMS-Timestamp と本文から同じ値を計算して検証できます
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
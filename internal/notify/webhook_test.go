@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	srv, c := newCapture(t, http.StatusOK, "")
+	n := &WebhookNotifier{URL: srv.URL, Secret: "s3cret"}
+	msg := testMessage(1)
+	msg.RunID = "run-1"
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	req, body := c.requests[0], c.bodies[0]
+	timestamp := req.Header.Get(HeaderTimestamp)
+	if ts, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Fatalf("%s ヘッダーが現在時刻ではありません: %q", HeaderTimestamp, timestamp)
+	}
+
+	// 受信側と同じ手順で、生の本文から署名を計算し直して比較する
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	got := req.Header.Get(HeaderSignature)
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		t.Fatalf("署名が一致しません: %s = %q, want %q", HeaderSignature, got, want)
+	}
+	if req.Header.Get(HeaderEvent) != EventAssignmentsChanged || req.Header.Get(HeaderRunID) != "run-1" {
+		t.Errorf("イベント・実行IDのヘッダー: %v", req.Header)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Version != WebhookPayloadVersion || payload.Event != EventAssignmentsChanged || len(payload.Assignments) != 1 || payload.Changes == nil {
+		t.Errorf("ペイロード: %+v", payload)
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	srv, c := newCapture(t, http.StatusOK, "")
+	n := &WebhookNotifier{URL: srv.URL}
+	if err := n.Send(context.Background(), testMessage(0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.requests[0].Header[HeaderSignature]; ok {
+		t.Errorf("シークレットがないのに %s ヘッダーを送りました", HeaderSignature)
+	}
+	if c.requests[0].Header.Get(HeaderTimestamp) == "" {
+		t.Errorf("%s ヘッダーがありません", HeaderTimestamp)
+	}
+	// 課題がなくても配列として送る
+	if !strings.Contains(string(c.bodies[0]), `"assignments":[]`) || !strings.Contains(string(c.bodies[0]), `"changes":[]`) {
+		t.Errorf("課題・変更が空の配列になっていません: %s", c.bodies[0])
+	}
+}
+
+func TestWebhookRetriesServerErrors(t *testing.T) {
+	srv, c := newCapture(t, http.StatusOK, "")
+	c.statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}
+	n := &WebhookNotifier{URL: srv.URL, Secret: "s3cret", RetryDelay: time.Millisecond}
+	if err := n.Send(context.Background(), testMessage(1)); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.bodies) != 3 {
+		t.Fatalf("送信回数: %d, want 3", len(c.bodies))
+	}
+	if string(c.bodies[0]) != string(c.bodies[2]) {
+		t.Errorf("再送で本文が変わりました")
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	srv, c := newCapture(t, http.StatusInternalServerError, "")
+	n := &WebhookNotifier{URL: srv.URL, RetryDelay: time.Millisecond}
+	if err := n.Send(context.Background(), testMessage(1)); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("500 のエラーが返されていません: %v", err)
+	}
+	if len(c.requests) != WebhookMaxAttempts {
+		t.Errorf("送信回数: %d, want %d", len(c.requests), WebhookMaxAttempts)
+	}
+}
+
+func TestWebhookDoesNotRetryClientErrors(t *testing.T) {
+	srv, c := newCapture(t, http.StatusUnauthorized, "")
+	n := &WebhookNotifier{URL: srv.URL, RetryDelay: time.Millisecond}
+	if err := n.Send(context.Background(), testMessage(1)); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("401 のエラーが返されていません: %v", err)
+	}
+	if len(c.requests) != 1 {
+		t.Errorf("送信回数: %d（4xx は再送しないはず）", len(c.requests))
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -14,27 +14,42 @@ import (
 
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/option"
+
+	"klms-go/internal/storage"
 )
 
 // 設定ファイルパス
 const (
-	DailyLimitFile    = "data/daily-gemini-count.json" // Gemini APIの1日あたりの使用回数を記録
-	CourseListFile    = "data/courses.json"            // 登録済み科目リストのパス
-	OcrCacheFile      = "data/ocr-cache.json"          // 画像ハッシュとOCR結果のキャッシュ
-	MaxGeminiPerDay   = 20                              // Gemini APIの1日あたりの使用制限（環境変数MAX_GEMINI_PER_DAYで上書き可能）
+	CourseListFile = "data/courses.json" // 登録済み科目リストのパス
 )
 
-// DailyData は1日あたりのGemini API使用回数を記録します
-type DailyData struct {
-	Date  string `json:"date"`  // 日付（YYYY-MM-DD形式）
-	Count int    `json:"count"` // 使用回数
-}
+// DryRun が true の場合、OCRは実行しますが使用回数・キャッシュを保存しません（--dry-run 用）
+var DryRun bool
+
+// DeadlineLayout は Assignment.Deadline の書式です（日本時間）
+const DeadlineLayout = "2006-01-02 15:04"
+
+// JST は期限の解釈に使うタイムゾーンです（tzdataがない環境では固定オフセット）
+var JST = storage.JST
 
 // Assignment は課題情報を保持します
 type Assignment struct {
 	Course   string `json:"course"`   // 授業名（教員名含む）
 	Title    string `json:"title"`    // 課題名
 	Deadline string `json:"deadline"` // 期限（YYYY-MM-DD HH:mm形式）
+
+	// 以下はCanvas APIなど構造化データから取得できる場合のみ設定されます
+	CourseID  string  `json:"course_id,omitempty"` // CanvasのコースID
+	URL       string  `json:"url,omitempty"`       // 課題ページのURL
+	Type      string  `json:"type,omitempty"`      // 種別（assignment, quiz, discussion_topic など）
+	SourceID  string  `json:"source_id,omitempty"` // 取得元での一意ID（例: canvas:assignment:123）
+	Completed bool    `json:"completed,omitempty"` // 提出済み・完了済みか
+	Points    float64 `json:"points,omitempty"`    // 配点
+}
+
+// ParseDeadline は Deadline 文字列を日本時間として解釈します
+func ParseDeadline(deadline string) (time.Time, error) {
+	return time.ParseInLocation(DeadlineLayout, deadline, JST)
 }
 
 // OCRキャッシュ用の構造体
@@ -62,17 +77,17 @@ func calculateImageHash(imagePath string) (string, error) {
 // OCRキャッシュを読み込む
 func loadOcrCache() *OcrCache {
 	cache := &OcrCache{Entries: []OcrCacheEntry{}}
-	if data, err := ioutil.ReadFile(OcrCacheFile); err == nil {
-		json.Unmarshal(data, cache)
+	if _, err := storage.Load(storage.BucketCache, storage.KeyOCRCache, cache); err != nil {
+		log.Printf("⚠️ OCRキャッシュの読み込みエラー: %v", err)
 	}
 	return cache
 }
 
 // OCRキャッシュを保存
 func saveOcrCache(cache *OcrCache) {
-	data, _ := json.MarshalIndent(cache, "", "  ")
-	os.MkdirAll("data", 0755)
-	ioutil.WriteFile(OcrCacheFile, data, 0644)
+	if err := storage.Save(storage.BucketCache, storage.KeyOCRCache, cache); err != nil {
+		log.Printf("⚠️ OCRキャッシュの保存エラー: %v", err)
+	}
 }
 
 // キャッシュからOCR結果を取得
@@ -129,9 +144,9 @@ func ExtractAssignmentInfo(imagePath string) (string, []Assignment, error) {
 	}
 	
 	// キャッシュにない場合、Gemini APIを使用
+	// 上限に達した場合は、課題ソースの次の候補（tesseract など）に任せる
 	if !canRunGeminiToday() {
-		log.Printf("⚠️ Gemini APIの1日あたりの使用制限（%d回）に達しました。OCRをスキップします。", MaxGeminiPerDay)
-		return "実行制限到達のためOCRスキップ", nil, nil
+		return "", nil, ErrGeminiQuota
 	}
 	
 	log.Printf("🔍 新しい画像を検出しました。Gemini APIでOCRを実行します...")
@@ -153,17 +168,53 @@ func ExtractAssignmentInfo(imagePath string) (string, []Assignment, error) {
 		return "", nil, fmt.Errorf("画像読み込みエラー: %v", err)
 	}
 
+	model := client.GenerativeModel("gemini-2.5-flash")
+	// 出力をスキーマどおりのJSONに限定する（コードブロックや説明文が混ざらない）
+	model.ResponseMIMEType = "application/json"
+	model.ResponseSchema = assignmentSchema
+
+	prompt := genai.Text(extractionPrompt())
+	rawJSON, err := generateJSON(ctx, model, prompt, genai.ImageData("png", imgData))
+	if err != nil {
+		return "", nil, err
+	}
+	assignments, err := decodeAssignments(rawJSON)
+	if err != nil {
+		// スキーマに合わない場合は、理由を伝えて1回だけ作り直してもらう
+		log.Printf("⚠️ Geminiの出力を修正して再取得します: %v\n生データ: %s", err, rawJSON)
+		repair := genai.Text(repairPrompt(err, rawJSON))
+		if rawJSON, err = generateJSON(ctx, model, prompt, genai.ImageData("png", imgData), repair); err != nil {
+			return "", nil, err
+		}
+		if assignments, err = decodeAssignments(rawJSON); err != nil {
+			// 生の出力を通知に使わないよう、エラーとして扱う
+			log.Printf("⚠️ 再取得した出力も不正でした\n生データ: %s", rawJSON)
+			return "", nil, fmt.Errorf("GeminiのOCR結果を課題一覧として解釈できませんでした: %v", err)
+		}
+	}
+	log.Printf("✅ Gemini APIでOCR完了")
+
+	notifyText := FormatAssignments(assignments)
+
+	// OCR結果をキャッシュに保存
+	if !DryRun {
+		saveOcrResult(imageHash, notifyText, assignments)
+	}
+	
+	return notifyText, assignments, nil
+}
+
+// extractionPrompt は画像から課題を抽出するプロンプトです（Gemini・OpenAI互換APIで共通）
+func extractionPrompt() string {
 	// ★追加: 科目リストを読み込む
 	courseListJSON := "[]"
 	if data, err := ioutil.ReadFile(CourseListFile); err == nil {
 		courseListJSON = string(data)
 	}
 
-	model := client.GenerativeModel("gemini-2.5-flash")
-
 	// ★修正: プロンプトに科目リスト(Known Courses)を含める
 	currentYear := time.Now().Year()
-	prompt := genai.Text(fmt.Sprintf(`
+	return fmt.Sprintf(`
 この画像はK-LMSのダッシュボードです。
 以下の「登録済み科目リスト」を参照し、検出された授業名がリスト内のものと一致、あるいは類似している場合は、**必ずリスト内の正式名称（教員名含む）**に修正して出力してください。
 
@@ -174,65 +225,38 @@ func ExtractAssignmentInfo(imagePath string) (string, []Assignment, error) {
 1. course: 授業名。可能な限り上記のリストにある名称を使用すること。リストにない場合は画像内の表記に従うが、教員名がわかる場合は "授業名 (教員名)" の形式にすること。
 2. title: 課題名
 3. deadline: 期限 (現在は%d年です。"YYYY-MM-DD HH:mm" 形式に変換すること)
-
-出力は**JSON配列形式のみ**で行ってください。
+4. type・url・points: 画像から読み取れる場合のみ出力し、わからない場合は省略すること
 
 出力例:
 [
   {"course": "造形・デザイン論 (荒木 文果)", "title": "小テスト (7)", "deadline": "2025-12-07 23:59"},
   {"course": "統計学基礎 (藪 友良)", "title": "課題1", "deadline": "2026-01-13 23:59"}
 ]
-`, courseListJSON, currentYear))
-
-	resp, err := model.GenerateContent(ctx, prompt, genai.ImageData("png", imgData))
-	if err != nil {
-		return "", nil, fmt.Errorf("Gemini生成エラー: %v", err)
-	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "読み取り結果なし", nil, nil
-	}
-
-	var rawJSON string
-	for _, part := range resp.Candidates[0].Content.Parts {
-		if txt, ok := part.(genai.Text); ok {
-			rawJSON += string(txt)
-		}
-	}
-
-	rawJSON = strings.TrimSpace(rawJSON)
-	rawJSON = strings.TrimPrefix(rawJSON, "```json")
-	rawJSON = strings.TrimPrefix(rawJSON, "```")
-	rawJSON = strings.TrimSuffix(rawJSON, "```")
+`, courseListJSON, currentYear)
+}
 
-	incrementGeminiCount()
-	log.Printf("✅ Gemini APIでOCR完了")
+// repairPrompt はスキーマに合わない出力の修正を依頼するプロンプトです
+func repairPrompt(err error, raw string) string {
+	return fmt.Sprintf("前回の出力は次の理由で不正でした。同じ画像から、指摘を修正したJSON配列を出力し直してください。\n\n%v\n\n【前回の出力】\n%s", err, raw)
+}
 
-	var assignments []Assignment
-	if err := json.Unmarshal([]byte(rawJSON), &assignments); err != nil {
-		log.Printf("JSONパース失敗: %v \n生データ: %s", err, rawJSON)
-		return rawJSON, nil, nil
+// FormatAssignments は課題一覧を通知用のテキストに整形します
+func FormatAssignments(assignments []Assignment) string {
+	if len(assignments) == 0 {
+		return "課題は見つかりませんでした"
 	}
-
 	var notifyText string
-	if len(assignments) == 0 {
-		notifyText = "課題は見つかりませんでした"
-	} else {
-		for _, a := range assignments {
-			dateStr := formatDeadline(a.Deadline)
-			// 通知フォーマット
-			notifyText += fmt.Sprintf("【コース詳細】%s\n【課題】%s\n【期限】%s\n---\n", a.Course, a.Title, dateStr)
-		}
+	for _, a := range assignments {
+		dateStr := FormatDeadline(a.Deadline)
+		// 通知フォーマット
+		notifyText += fmt.Sprintf("【コース詳細】%s\n【課題】%s\n【期限】%s\n---\n", a.Course, a.Title, dateStr)
 	}
-	
-	// OCR結果をキャッシュに保存
-	saveOcrResult(imageHash, notifyText, assignments)
-	
-	return notifyText, assignments, nil
+	return notifyText
 }
 
-func formatDeadline(isoDate string) string {
-	t, err := time.Parse("2006-01-02 15:04", isoDate)
+// FormatDeadline は期限を「1月2日 15:04」のような表示用の形式に変換します
+func FormatDeadline(isoDate string) string {
+	t, err := time.Parse(DeadlineLayout, isoDate)
 	if err != nil {
 		return isoDate
 	}
@@ -243,43 +267,47 @@ func formatDeadline(isoDate string) string {
 	return t.Format("2006年1月2日 15:04")
 }
 
-func loadDailyCount() DailyData {
-	data := DailyData{Date: time.Now().Format("2006-01-02"), Count: 0}
-	file, err := ioutil.ReadFile(DailyLimitFile)
-	if err == nil {
-		json.Unmarshal(file, &data)
-	}
-	return data
-}
+// ErrGeminiQuota はGemini APIの1日あたりの使用上限に達したため呼び出さなかったことを表します
+var ErrGeminiQuota = errors.New("Gemini APIの1日あたりの使用上限に達したためOCRをスキップしました")
 
-func saveDailyCount(data DailyData) {
-	file, _ := json.MarshalIndent(data, "", "  ")
-	os.MkdirAll("data", 0755)
-	ioutil.WriteFile(DailyLimitFile, file, 0644)
+// generateJSON はGemini APIを1回呼び出し、出力のテキストを返します
+func generateJSON(ctx context.Context, model *genai.GenerativeModel, parts ...genai.Part) (string, error) {
+	// 失敗したリクエストも無料枠を消費するため、呼び出す前に使用回数を増やす
+	if err := reserveGemini(); err != nil {
+		log.Printf("⚠️ %v", err)
+		return "", ErrGeminiQuota
+	}
+	resp, err := model.GenerateContent(ctx, parts...)
+	if err != nil {
+		return "", fmt.Errorf("Gemini生成エラー: %v", err)
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("Geminiの読み取り結果がありません")
+	}
+	var text string
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if txt, ok := part.(genai.Text); ok {
+			text += string(txt)
+		}
+	}
+	return strings.TrimSpace(text), nil
 }
 
+// canRunGeminiToday は本日まだGemini APIを使えるかを返します
 func canRunGeminiToday() bool {
-	data := loadDailyCount()
-	today := time.Now().Format("2006-01-02")
-
-	if data.Date != today {
-		saveDailyCount(DailyData{Date: today, Count: 0})
-		log.Printf("📊 Gemini API使用回数: 0/%d (本日リセット)", MaxGeminiPerDay)
-		return true
-	}
-	remaining := MaxGeminiPerDay - data.Count
-	log.Printf("📊 Gemini API使用回数: %d/%d (残り: %d回)", data.Count, MaxGeminiPerDay, remaining)
-	return data.Count < MaxGeminiPerDay
+	status := storage.QuotaStatusOf(storage.QuotaGemini)
+	log.Printf("📊 Gemini API使用回数: %s", status)
+	return status.Remaining() > 0
 }
 
-func incrementGeminiCount() {
-	data := loadDailyCount()
-	today := time.Now().Format("2006-01-02")
-
-	if data.Date != today {
-		data = DailyData{Date: today, Count: 1}
-	} else {
-		data.Count++
+// reserveGemini はGemini APIの使用回数を1増やします（dry-runでは上限の確認だけを行います）
+func reserveGemini() error {
+	if DryRun {
+		if status := storage.QuotaStatusOf(storage.QuotaGemini); status.Remaining() == 0 {
+			return &storage.QuotaExceededError{QuotaStatus: status}
+		}
+		return nil
 	}
-	saveDailyCount(data)
-}
\ No newline at end of file
+	_, err := storage.Reserve(storage.QuotaGemini)
+	return err
+}
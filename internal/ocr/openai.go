@@ -0,0 +1,222 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// DefaultOpenAIBaseURL はローカルのOllamaのOpenAI互換APIです
+const DefaultOpenAIBaseURL = "http://localhost:11434/v1"
+
+// OpenAICompatible はOpenAI互換のChat Completions API（Ollama・LM Studio・vLLMなど）の
+// 画像入力に対応したモデルでスクリーンショットを読み取ります
+// ローカルで動かせば画像が外部に送られることはなく、使用回数の制限もありません
+type OpenAICompatible struct {
+	BaseURL string // 例: http://localhost:11434/v1（末尾の /chat/completions は不要）
+	Model   string // 例: qwen2.5vl:7b
+	APIKey  string // 空なら Authorization ヘッダーを付けない
+	HTTP    *http.Client
+}
+
+// chatMessage はChat Completions APIのメッセージです
+type chatMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // 文字列、またはテキストと画像のパーツの配列
+}
+
+type chatPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+type imageURL struct {
+	URL string `json:"url"`
+}
+
+// ExtractAssignments は画像を読み取り、課題一覧と通知用テキストを返します
+// 出力がスキーマに合わない場合は、理由を伝えて1回だけ作り直してもらいます
+func (o *OpenAICompatible) ExtractAssignments(ctx context.Context, imagePath string) (string, []Assignment, error) {
+	if o.Model == "" {
+		return "", nil, fmt.Errorf("OPENAI_MODELが設定されていません")
+	}
+	imgData, err := ioutil.ReadFile(imagePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("画像読み込みエラー: %v", err)
+	}
+	log.Printf("🔍 %s（%s）でOCRを実行します...", o.Model, o.baseURL())
+
+	dataURL := "data:" + http.DetectContentType(imgData) + ";base64," + base64.StdEncoding.EncodeToString(imgData)
+	messages := []chatMessage{{
+		Role: "user",
+		Content: []chatPart{
+			{Type: "text", Text: extractionPrompt() + "\n出力は {\"assignments\": [...]} の形のJSONオブジェクトにしてください。"},
+			{Type: "image_url", ImageURL: &imageURL{URL: dataURL}},
+		},
+	}}
+
+	raw, err := o.complete(ctx, messages)
+	if err != nil {
+		return "", nil, err
+	}
+	assignments, err := decodeWrappedAssignments(raw)
+	if err != nil {
+		log.Printf("⚠️ %s の出力を修正して再取得します: %v\n生データ: %s", o.Model, err, raw)
+		messages = append(messages,
+			chatMessage{Role: "assistant", Content: raw},
+			chatMessage{Role: "user", Content: repairPrompt(err, raw)},
+		)
+		if raw, err = o.complete(ctx, messages); err != nil {
+			return "", nil, err
+		}
+		if assignments, err = decodeWrappedAssignments(raw); err != nil {
+			log.Printf("⚠️ 再取得した出力も不正でした\n生データ: %s", raw)
+			return "", nil, fmt.Errorf("%s のOCR結果を課題一覧として解釈できませんでした: %v", o.Model, err)
+		}
+	}
+	log.Printf("✅ %s で %d 件の課題を抽出しました", o.Model, len(assignments))
+	return FormatAssignments(assignments), assignments, nil
+}
+
+func (o *OpenAICompatible) baseURL() string {
+	if o.BaseURL == "" {
+		return DefaultOpenAIBaseURL
+	}
+	return strings.TrimSuffix(o.BaseURL, "/")
+}
+
+// complete はChat Completions APIを1回呼び出し、応答のテキストを返します
+func (o *OpenAICompatible) complete(ctx context.Context, messages []chatMessage) (string, error) {
+	payload := map[string]interface{}{
+		"model":       o.Model,
+		"messages":    messages,
+		"temperature": 0,
+		"response_format": map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name": "assignments",
+				"schema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"assignments": jsonSchema(assignmentSchema)},
+					"required":   []string{"assignments"},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL()+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	client := o.HTTP
+	if client == nil {
+		// ローカルのモデルは画像の読み取りに時間がかかることがある
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("OpenAI互換APIへの接続エラー: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("OpenAI互換APIのエラー: %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("OpenAI互換APIの応答の解析エラー: %v", err)
+	}
+	if len(result.Choices) == 0 || strings.TrimSpace(result.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("OpenAI互換APIの読み取り結果がありません")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
+
+// decodeWrappedAssignments は {"assignments": [...]} の形の出力を読み込み、内容を検証します
+// response_format に対応していないサーバーもあるため、JSON配列だけの出力とコードブロックも受け付けます
+func decodeWrappedAssignments(raw string) ([]Assignment, error) {
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimPrefix(raw, "```json")
+	raw = strings.TrimPrefix(raw, "```")
+	raw = strings.TrimSpace(strings.TrimSuffix(raw, "```"))
+
+	var wrapped struct {
+		Assignments json.RawMessage `json:"assignments"`
+	}
+	if strings.HasPrefix(raw, "{") {
+		if err := json.Unmarshal([]byte(raw), &wrapped); err != nil {
+			return nil, fmt.Errorf("JSONオブジェクトとして解析できません: %v", err)
+		}
+		if wrapped.Assignments == nil {
+			return nil, fmt.Errorf("assignments がありません")
+		}
+		raw = string(wrapped.Assignments)
+	}
+	return decodeAssignments(raw)
+}
+
+// jsonSchema はGemini用のスキーマを、OpenAI互換APIの response_format で使うJSON Schemaに変換します
+func jsonSchema(s *genai.Schema) map[string]interface{} {
+	types := map[genai.Type]string{
+		genai.TypeString: "string", genai.TypeNumber: "number", genai.TypeInteger: "integer",
+		genai.TypeBoolean: "boolean", genai.TypeArray: "array", genai.TypeObject: "object",
+	}
+	out := map[string]interface{}{"type": types[s.Type]}
+	if s.Nullable {
+		// 省略できる項目は null も受け付ける（厳密にスキーマを守るサーバーが null を拒否しないように）
+		out["type"] = []string{types[s.Type], "null"}
+	}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		enum := make([]interface{}, 0, len(s.Enum)+1)
+		for _, v := range s.Enum {
+			enum = append(enum, v)
+		}
+		if s.Nullable {
+			enum = append(enum, nil)
+		}
+		out["enum"] = enum
+	}
+	if s.Items != nil {
+		out["items"] = jsonSchema(s.Items)
+	}
+	if len(s.Properties) > 0 {
+		props := map[string]interface{}{}
+		for name, p := range s.Properties {
+			props[name] = jsonSchema(p)
+		}
+		out["properties"] = props
+	}
+	if len(s.Required) > 0 {
+		out["required"] = s.Required
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package ocr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chatRequest はテスト用に読み込むChat Completionsのリクエストです
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	ResponseFormat struct {
+		Type       string `json:"type"`
+		JSONSchema struct {
+			Schema struct {
+				Properties struct {
+					Assignments struct {
+						Items struct {
+							Properties map[string]struct {
+								Type json.RawMessage `json:"type"`
+							} `json:"properties"`
+						} `json:"items"`
+					} `json:"assignments"`
+				} `json:"properties"`
+			} `json:"schema"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+// fakeChatServer は受け取ったリクエストを記録し、replies を順に返すサーバーです
+func fakeChatServer(t *testing.T, replies ...string) (*httptest.Server, *[]*http.Request, *[]chatRequest) {
+	t.Helper()
+	var requests []*http.Request
+	var bodies []chatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		reply := replies[len(bodies)-1]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]string{"role": "assistant", "content": reply}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests, &bodies
+}
+
+func writeImage(t *testing.T) (string, []byte) {
+	t.Helper()
+	data := []byte("\x89PNG\r\n\x1a\nfake image")
+	path := filepath.Join(t.TempDir(), "screenshot.png")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+const validReply = `{"assignments":[{"course":"統計学基礎 (藪 友良)","title":"課題1","deadline":"2026-01-13 23:59","url":null}]}`
+
+func TestOpenAICompatibleRequest(t *testing.T) {
+	srv, requests, bodies := fakeChatServer(t, validReply)
+	path, data := writeImage(t)
+
+	engine := &OpenAICompatible{BaseURL: srv.URL + "/v1/", Model: "qwen2.5vl:7b", APIKey: "secret"}
+	_, assignments, err := engine.ExtractAssignments(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 1 || assignments[0].Title != "課題1" || assignments[0].Deadline != "2026-01-13 23:59" {
+		t.Fatalf("assignments = %+v", assignments)
+	}
+
+	r, body := (*requests)[0], (*bodies)[0]
+	if r.Method != "POST" || r.URL.Path != "/v1/chat/completions" {
+		t.Errorf("request = %s %s", r.Method, r.URL.Path)
+	}
+	if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if body.Model != "qwen2.5vl:7b" || len(body.Messages) != 1 || body.Messages[0].Role != "user" {
+		t.Fatalf("unexpected body: %+v", body)
+	}
+
+	var parts []chatPart
+	if err := json.Unmarshal(body.Messages[0].Content, &parts); err != nil || len(parts) != 2 {
+		t.Fatalf("content parts = %s (%v)", body.Messages[0].Content, err)
+	}
+	if parts[0].Type != "text" || !strings.Contains(parts[0].Text, "assignments") {
+		t.Errorf("text part = %+v", parts[0])
+	}
+	const prefix = "data:image/png;base64,"
+	if parts[1].Type != "image_url" || parts[1].ImageURL == nil || !strings.HasPrefix(parts[1].ImageURL.URL, prefix) {
+		t.Fatalf("image part = %+v", parts[1])
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(parts[1].ImageURL.URL, prefix)); err != nil || string(decoded) != string(data) {
+		t.Errorf("image data does not round-trip (%v)", err)
+	}
+
+	// 省略できる項目は null を許し、必須の項目は許さない
+	if body.ResponseFormat.Type != "json_schema" {
+		t.Errorf("response_format.type = %q", body.ResponseFormat.Type)
+	}
+	props := body.ResponseFormat.JSONSchema.Schema.Properties.Assignments.Items.Properties
+	for name, want := range map[string]string{"url": `["string","null"]`, "points": `["number","null"]`, "course": `"string"`} {
+		if got := string(props[name].Type); got != want {
+			t.Errorf("schema %s type = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestOpenAICompatibleWithoutKey(t *testing.T) {
+	srv, requests, _ := fakeChatServer(t, validReply)
+	path, _ := writeImage(t)
+
+	engine := &OpenAICompatible{BaseURL: srv.URL, Model: "llava"}
+	if _, _, err := engine.ExtractAssignments(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (*requests)[0].Header["Authorization"]; ok {
+		t.Errorf("Authorization header sent without a key: %q", (*requests)[0].Header.Get("Authorization"))
+	}
+}
+
+func TestOpenAICompatibleErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+	path, _ := writeImage(t)
+
+	engine := &OpenAICompatible{BaseURL: srv.URL, Model: "missing"}
+	_, assignments, err := engine.ExtractAssignments(context.Background(), path)
+	if err == nil || assignments != nil {
+		t.Fatalf("want error, got %v / %+v", err, assignments)
+	}
+	if !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "model not found") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestOpenAICompatibleRepairRetry(t *testing.T) {
+	invalid := `{"assignments":[{"course":"統計学","title":"課題1","deadline":"明日"}]}`
+	// 2回目はコードブロックで返す（response_format に対応していないサーバー）
+	srv, _, bodies := fakeChatServer(t, invalid, "```json\n"+validReply+"\n```")
+	path, _ := writeImage(t)
+
+	engine := &OpenAICompatible{BaseURL: srv.URL, Model: "llava"}
+	_, assignments, err := engine.ExtractAssignments(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 1 || assignments[0].Deadline != "2026-01-13 23:59" {
+		t.Fatalf("assignments = %+v", assignments)
+	}
+	if len(*bodies) != 2 {
+		t.Fatalf("requests = %d, want 2", len(*bodies))
+	}
+
+	// 作り直しの依頼には、前回の出力と不正だった理由を含める
+	retry := (*bodies)[1].Messages
+	if len(retry) != 3 || retry[1].Role != "assistant" || retry[2].Role != "user" {
+		t.Fatalf("retry messages = %+v", retry)
+	}
+	var repair string
+	if err := json.Unmarshal(retry[2].Content, &repair); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(repair, `deadline "明日"`) || !strings.Contains(repair, invalid) {
+		t.Errorf("repair prompt = %q", repair)
+	}
+}
+
+func TestOpenAICompatibleGivesUpAfterOneRetry(t *testing.T) {
+	srv, _, bodies := fakeChatServer(t, `[]x`, `{"items":[]}`)
+	path, _ := writeImage(t)
+
+	engine := &OpenAICompatible{BaseURL: srv.URL, Model: "llava"}
+	if _, _, err := engine.ExtractAssignments(context.Background(), path); err == nil {
+		t.Fatal("want error for invalid output")
+	}
+	if len(*bodies) != 2 {
+		t.Errorf("requests = %d, want 2", len(*bodies))
+	}
+}
@@ -0,0 +1,78 @@
+package ocr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// assignmentTypes は Assignment.Type に使える値です（Canvasのプランナーの種別）
+var assignmentTypes = []string{"assignment", "quiz", "discussion_topic", "wiki_page", "planner_note", "calendar_event"}
+
+// assignmentSchema はGeminiに返させるJSONの形です（ResponseSchema）
+var assignmentSchema = &genai.Schema{
+	Type: genai.TypeArray,
+	Items: &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"course":   {Type: genai.TypeString, Description: "授業名。教員名がわかる場合は「授業名 (教員名)」"},
+			"title":    {Type: genai.TypeString, Description: "課題名"},
+			"deadline": {Type: genai.TypeString, Description: "期限（YYYY-MM-DD HH:mm、日本時間）"},
+			"type":     {Type: genai.TypeString, Format: "enum", Enum: assignmentTypes, Description: "種別（わかる場合のみ）", Nullable: true},
+			"url":      {Type: genai.TypeString, Description: "課題ページのURL（画像に表示されている場合のみ）", Nullable: true},
+			"points":   {Type: genai.TypeNumber, Description: "配点（表示されている場合のみ）", Nullable: true},
+		},
+		Required: []string{"course", "title", "deadline"},
+	},
+}
+
+// decodeAssignments はGeminiの出力をJSONとして読み込み、内容を検証します
+// 問題があった場合は、修正を依頼するプロンプトにそのまま使える説明をエラーとして返します
+func decodeAssignments(raw string) ([]Assignment, error) {
+	var assignments []Assignment
+	if err := json.Unmarshal([]byte(raw), &assignments); err != nil {
+		return nil, fmt.Errorf("JSON配列として解析できません: %v", err)
+	}
+
+	var problems []string
+	for i, a := range assignments {
+		prefix := fmt.Sprintf("%d件目", i+1)
+		if strings.TrimSpace(a.Course) == "" {
+			problems = append(problems, prefix+": course が空です")
+		}
+		if strings.TrimSpace(a.Title) == "" {
+			problems = append(problems, prefix+": title が空です")
+		}
+		if _, err := time.Parse(DeadlineLayout, a.Deadline); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: deadline %q が YYYY-MM-DD HH:mm 形式ではありません", prefix, a.Deadline))
+		}
+		if a.Type != "" && !containsString(assignmentTypes, a.Type) {
+			problems = append(problems, fmt.Sprintf("%s: type %q は %s のいずれかにしてください", prefix, a.Type, strings.Join(assignmentTypes, ", ")))
+		}
+		if a.URL != "" {
+			if u, err := url.Parse(a.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("%s: url %q が不正です（不明なら省略してください）", prefix, a.URL))
+			}
+		}
+		if a.Points < 0 {
+			problems = append(problems, fmt.Sprintf("%s: points が負の値です", prefix))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("出力が仕様に合っていません:\n- %s", strings.Join(problems, "\n- "))
+	}
+	return assignments, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Tesseract はローカルのTesseractでスクリーンショットを読み取ります（API不要・使用回数の制限なし）
+// 読み取ったテキストは ParsePlannerText でルールベースに解析します
+type Tesseract struct {
+	Path     string // 実行ファイル（空なら PATH 上の tesseract）
+	Language string // 言語（空なら jpn+eng）
+}
+
+// DefaultTesseractLanguage は日本語と英語の混在したダッシュボード向けの既定の言語です
+const DefaultTesseractLanguage = "jpn+eng"
+
+// Recognize は画像のテキストを読み取ります
+func (t *Tesseract) Recognize(ctx context.Context, imagePath string) (string, error) {
+	path := t.Path
+	if path == "" {
+		path = "tesseract"
+	}
+	lang := t.Language
+	if lang == "" {
+		lang = DefaultTesseractLanguage
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		return "", fmt.Errorf("tesseractが見つかりません（インストールするか TESSERACT_PATH を設定してください）: %v", err)
+	}
+
+	// --psm 4: 1列の可変サイズのテキストとして読む（プランナーの縦に並んだ一覧に合う）
+	cmd := exec.CommandContext(ctx, path, imagePath, "stdout", "-l", lang, "--psm", "4")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseractの実行エラー: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return normalizeOCRText(stdout.String()), nil
+}
+
+// ExtractAssignments は画像を読み取り、課題一覧と通知用テキストを返します
+func (t *Tesseract) ExtractAssignments(ctx context.Context, imagePath string) (string, []Assignment, error) {
+	log.Printf("🔍 TesseractでOCRを実行します...")
+	text, err := t.Recognize(ctx, imagePath)
+	if err != nil {
+		return "", nil, err
+	}
+	assignments, err := ParsePlannerText(text, time.Now())
+	if err != nil {
+		return "", nil, fmt.Errorf("Tesseractの読み取り結果から課題を抽出できませんでした: %v", err)
+	}
+	log.Printf("✅ Tesseractで %d 件の課題を抽出しました", len(assignments))
+	return FormatAssignments(assignments), assignments, nil
+}
+
+// normalizeOCRText はOCR特有の揺れを ParsePlannerText が扱える形に整えます
+// - 日本語の文字の間に入る余分な空白を取り除く（「課 題」→「課題」）
+// - 全角の数字・コロンを半角にする
+func normalizeOCRText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= '０' && r <= '９':
+			return r - '０' + '0'
+		case r == '：':
+			return ':'
+		case r == '\f':
+			return '\n'
+		}
+		return r
+	}, s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		runes := []rune(strings.TrimSpace(line))
+		var b strings.Builder
+		for j, r := range runes {
+			if r == ' ' && j > 0 && j < len(runes)-1 && isWide(runes[j-1]) && isWide(runes[j+1]) {
+				continue
+			}
+			b.WriteRune(r)
+		}
+		lines[i] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isWide は日本語（かな・漢字・全角記号）の文字かを返します
+func isWide(r rune) bool {
+	return r >= 0x3000
+}
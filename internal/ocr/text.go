@@ -0,0 +1,218 @@
+package ocr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// プランナーのテキストを解析するためのパターン
+var (
+	jpDatePattern  = regexp.MustCompile(`(?:(\d{4})年\s*)?(\d{1,2})月\s*(\d{1,2})日`)
+	enDatePattern  = regexp.MustCompile(`(?i)\b(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?\s+(\d{1,2})\b`)
+	timePattern    = regexp.MustCompile(`(?i)(午前|午後)?\s*(\d{1,2})\s*[:：]\s*(\d{2})\s*(am|pm)?`)
+	timePrefix     = regexp.MustCompile(`(?i)^(期限|締切|締め切り|due)[\s:：]`)
+	pointsPattern  = regexp.MustCompile(`(?i)^\d+(\.\d+)?\s*(点|pts?|points?)$`)
+	completedWords = []string{"完了", "提出済み", "提出済", "completed", "submitted", "graded", "採点済み"}
+	relativeDays   = map[string]int{"今日": 0, "明日": 1, "昨日": -1, "today": 0, "tomorrow": 1, "yesterday": -1}
+	itemTypeLabels = map[string]string{
+		"課題": "assignment", "assignment": "assignment",
+		"小テスト": "quiz", "quiz": "quiz",
+		"ディスカッション": "discussion_topic", "discussion": "discussion_topic",
+		"ページ": "wiki_page", "page": "wiki_page",
+		"todo": "planner_note", "to do": "planner_note",
+		"カレンダーイベント": "calendar_event", "calendar event": "calendar_event",
+	}
+	englishMonths = map[string]time.Month{
+		"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+		"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+		"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+	}
+)
+
+// headingFiller は日付見出しで日付と一緒に表示される曜日・相対日・区切り記号です
+var headingFiller = regexp.MustCompile(`(?i)\b(sun|mon|tue|wed|thu|fri|sat)[a-z]*\b\.?|[（(]?[日月火水木金土](曜日?)?[)）]?|今日|明日|昨日|\b(today|tomorrow|yesterday)\b|[\s,、.・]`)
+
+// ParsePlannerText はダッシュボードのプランナーのテキスト（InnerTextやOCR結果）から課題を抽出します
+// LLMを使わないルールベースの抽出なので、レイアウトを認識できない場合はエラーを返します
+func ParsePlannerText(text string, now time.Time) ([]Assignment, error) {
+	now = now.In(JST)
+	var (
+		assignments []Assignment
+		day         *time.Time
+		course      string
+		pending     *Assignment
+		pendingType string
+		sawDate     bool
+		justFlushed bool // 直前の行が期限で、課題を確定した（期限の後の完了マークを付けるため）
+	)
+
+	flush := func(hour, min int) {
+		if pending == nil {
+			return
+		}
+		if day != nil {
+			due := time.Date(day.Year(), day.Month(), day.Day(), hour, min, 0, 0, JST)
+			pending.Deadline = due.Format(DeadlineLayout)
+			assignments = append(assignments, *pending)
+		}
+		pending = nil
+	}
+
+	for _, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(strings.ReplaceAll(raw, "　", " "))
+		if line == "" || pointsPattern.MatchString(line) {
+			continue
+		}
+
+		flushed := justFlushed
+		justFlushed = false
+
+		// 日付見出し
+		if d, ok := ParsePlannerDate(line, now); ok {
+			flush(23, 59)
+			day = &d
+			course = ""
+			sawDate = true
+			continue
+		}
+
+		// 種別ラベル（次の行が課題名）
+		if t := ItemType(line); t != "" {
+			flush(23, 59)
+			pendingType = t
+			continue
+		}
+
+		// 完了マーク（期限の行の後に表示されることもある）
+		if isCompletedLine(line) {
+			switch {
+			case pending != nil:
+				pending.Completed = true
+				continue
+			case flushed:
+				assignments[len(assignments)-1].Completed = true
+				continue
+			}
+		}
+
+		// 時刻（期限）
+		if pending != nil {
+			if hour, min, ok := ParseDueTime(line); ok {
+				flush(hour, min)
+				justFlushed = day != nil
+				continue
+			}
+		}
+
+		if pendingType != "" {
+			flush(23, 59)
+			pending = &Assignment{Course: course, Title: line, Type: pendingType}
+			pendingType = ""
+			continue
+		}
+
+		// 種別ラベル以外の行はコース名とみなす
+		flush(23, 59)
+		course = line
+	}
+	flush(23, 59)
+
+	if !sawDate {
+		return nil, fmt.Errorf("プランナーの日付見出しが見つかりません（未対応のレイアウト）")
+	}
+	return assignments, nil
+}
+
+// ParsePlannerDate は「1月13日 火曜日」「今日」「Tuesday, January 13」のような日付見出しを解釈します
+// 行全体が日付（と曜日）の場合だけ見出しとみなします（「12月5日講義レポート」のような課題名は見出しではない）
+func ParsePlannerDate(line string, now time.Time) (time.Time, bool) {
+	// 期限の行（「期限: 1月13日 23:59」など）は日付見出しではない
+	if timePrefix.MatchString(line) {
+		return time.Time{}, false
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, JST)
+
+	if loc := jpDatePattern.FindStringSubmatchIndex(line); loc != nil && onlyHeadingFiller(line, loc) {
+		m := jpDatePattern.FindStringSubmatch(line)
+		month, _ := strconv.Atoi(m[2])
+		dayNum, _ := strconv.Atoi(m[3])
+		if m[1] != "" {
+			year, _ := strconv.Atoi(m[1])
+			return time.Date(year, time.Month(month), dayNum, 0, 0, 0, 0, JST), true
+		}
+		return inferYear(today, time.Month(month), dayNum), true
+	}
+	if loc := enDatePattern.FindStringSubmatchIndex(line); loc != nil && onlyHeadingFiller(line, loc) {
+		m := enDatePattern.FindStringSubmatch(line)
+		month := englishMonths[strings.ToLower(m[1][:3])]
+		dayNum, _ := strconv.Atoi(m[2])
+		return inferYear(today, month, dayNum), true
+	}
+	if offset, ok := relativeDays[strings.ToLower(line)]; ok {
+		return today.AddDate(0, 0, offset), true
+	}
+	return time.Time{}, false
+}
+
+// onlyHeadingFiller は line のうち日付（loc の範囲）以外が曜日や区切り記号だけかを返します
+func onlyHeadingFiller(line string, loc []int) bool {
+	rest := line[:loc[0]] + " " + line[loc[1]:]
+	return headingFiller.ReplaceAllString(rest, "") == ""
+}
+
+// inferYear は年の書かれていない日付に年を補います（年をまたぐ場合を考慮）
+func inferYear(today time.Time, month time.Month, day int) time.Time {
+	d := time.Date(today.Year(), month, day, 0, 0, 0, 0, JST)
+	if today.Sub(d) > 180*24*time.Hour {
+		d = d.AddDate(1, 0, 0)
+	} else if d.Sub(today) > 180*24*time.Hour {
+		d = d.AddDate(-1, 0, 0)
+	}
+	return d
+}
+
+// ParseDueTime は「期限: 23:59」「Due: 11:59 PM」「午後11:59」のような時刻を解釈します
+func ParseDueTime(line string) (int, int, bool) {
+	if len(line) > 40 {
+		return 0, 0, false
+	}
+	m := timePattern.FindStringSubmatch(line)
+	if m == nil {
+		return 0, 0, false
+	}
+	hour, _ := strconv.Atoi(m[2])
+	min, _ := strconv.Atoi(m[3])
+	switch strings.ToLower(m[1] + m[4]) {
+	case "pm", "午後":
+		if hour < 12 {
+			hour += 12
+		}
+	case "am", "午前":
+		if hour == 12 {
+			hour = 0
+		}
+	}
+	if hour > 23 || min > 59 {
+		return 0, 0, false
+	}
+	return hour, min, true
+}
+
+// ItemType はプランナーの種別ラベル（「課題」「Quiz」など）をCanvasの種別名に変換します
+// 認識できない場合は空文字を返します
+func ItemType(label string) string {
+	return itemTypeLabels[strings.ToLower(strings.TrimSpace(label))]
+}
+
+func isCompletedLine(line string) bool {
+	lower := strings.ToLower(line)
+	for _, w := range completedWords {
+		if lower == w {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package ocr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePlannerText(t *testing.T) {
+	now := time.Date(2026, 12, 1, 10, 0, 0, 0, JST)
+	tests := []struct {
+		name string
+		text string
+		want []Assignment
+	}{
+		{
+			name: "基本のレイアウト",
+			text: `12月3日 木曜日
+情報処理
+課題
+第8回 演習
+期限: 23:59
+経済学
+小テスト
+確認テスト
+10点
+期限: 午後5:00`,
+			want: []Assignment{
+				{Course: "情報処理", Title: "第8回 演習", Deadline: "2026-12-03 23:59", Type: "assignment"},
+				{Course: "経済学", Title: "確認テスト", Deadline: "2026-12-03 17:00", Type: "quiz"},
+			},
+		},
+		{
+			name: "日付を含む課題名は見出しにしない",
+			text: `12月3日 木曜日
+情報処理
+課題
+12月5日講義レポート
+期限: 23:59
+課題
+第9回 演習
+期限: 18:00
+12月4日 金曜日
+経済学
+課題
+期末レポート`,
+			want: []Assignment{
+				{Course: "情報処理", Title: "12月5日講義レポート", Deadline: "2026-12-03 23:59", Type: "assignment"},
+				{Course: "情報処理", Title: "第9回 演習", Deadline: "2026-12-03 18:00", Type: "assignment"},
+				{Course: "経済学", Title: "期末レポート", Deadline: "2026-12-04 23:59", Type: "assignment"},
+			},
+		},
+		{
+			name: "期限の後の完了マーク",
+			text: `今日
+情報処理
+課題
+第8回 演習
+期限: 23:59
+完了
+経済学
+課題
+感想文
+完了
+期限: 12:00`,
+			want: []Assignment{
+				{Course: "情報処理", Title: "第8回 演習", Deadline: "2026-12-01 23:59", Type: "assignment", Completed: true},
+				{Course: "経済学", Title: "感想文", Deadline: "2026-12-01 12:00", Type: "assignment", Completed: true},
+			},
+		},
+		{
+			name: "英語表示と年をまたぐ日付",
+			text: `Tuesday, January 5
+Economics
+Quiz
+Week 1 Quiz
+Due: 11:59 PM`,
+			want: []Assignment{
+				{Course: "Economics", Title: "Week 1 Quiz", Deadline: "2027-01-05 23:59", Type: "quiz"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePlannerText(tt.text, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePlannerTextWithoutHeading(t *testing.T) {
+	_, err := ParsePlannerText("情報処理\n課題\n第8回 演習\n期限: 23:59", time.Now())
+	if err == nil || !strings.Contains(err.Error(), "日付見出し") {
+		t.Errorf("日付見出しがないのにエラーになりません: %v", err)
+	}
+}
+
+func TestParsePlannerDate(t *testing.T) {
+	now := time.Date(2026, 12, 1, 10, 0, 0, 0, JST)
+	tests := []struct {
+		line string
+		want string // 見出しでなければ空
+	}{
+		{"12月3日 木曜日", "2026-12-03"},
+		{"2027年1月5日（火）", "2027-01-05"},
+		{"1月5日 火曜日", "2027-01-05"},
+		{"今日 12月1日", "2026-12-01"},
+		{"明日", "2026-12-02"},
+		{"Tuesday, January 5", "2027-01-05"},
+		{"Nov. 30", "2026-11-30"},
+		{"12月5日講義レポート", ""},
+		{"期限: 12月3日 23:59", ""},
+		{"March 3 Essay Draft", ""},
+		{"情報処理", ""},
+	}
+	for _, tt := range tests {
+		d, ok := ParsePlannerDate(tt.line, now)
+		got := ""
+		if ok {
+			got = d.Format("2006-01-02")
+		}
+		if got != tt.want {
+			t.Errorf("ParsePlannerDate(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package reminder
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"klms-go/internal/diff"
+	"klms-go/internal/ocr"
+	"klms-go/internal/storage"
+)
+
+// Due は今回送るべきリマインダー1件です
+type Due struct {
+	Item     diff.Item
+	Offset   time.Duration // 期限の何時間前のリマインダーか
+	Deadline time.Time
+}
+
+// Fired は送信済みリマインダーの記録です（キー → 送信時刻）
+type Fired map[string]string
+
+// firedKey は課題・期限・オフセットごとのキーを作ります
+// 期限が変わった場合は別のキーになるので、新しい期限に対して改めて通知されます
+func firedKey(item diff.Item, offset time.Duration) string {
+	return fmt.Sprintf("%s|%s|%s", item.Key, item.Deadline, offset)
+}
+
+// LoadFired は送信済みの記録を読み込みます
+func LoadFired() Fired {
+	fired := Fired{}
+	if _, err := storage.Load(storage.BucketReminders, storage.KeyReminders, &fired); err != nil {
+		log.Printf("⚠️ リマインダーの記録の読み込みエラー: %v", err)
+	}
+	return fired
+}
+
+// Save は送信済みの記録を保存します
+func (f Fired) Save() error {
+	return storage.Save(storage.BucketReminders, storage.KeyReminders, f)
+}
+
+// Put はトランザクション内で送信済みの記録を保存します
+func (f Fired) Put(tx storage.Tx) error {
+	return storage.PutJSON(tx, storage.BucketReminders, storage.KeyReminders, f)
+}
+
+// Check は今回送るべきリマインダーを返し、該当するオフセットを送信済みとして fired に記録します
+// 実行されていなかった間に複数のオフセットを過ぎていた場合は、最も期限に近いものだけを返します
+// 完了済みの課題と期限を過ぎた課題は対象外です
+func Check(items []diff.Item, offsets []time.Duration, fired Fired, now time.Time) []Due {
+	var dues []Due
+	for _, item := range items {
+		if item.Completed {
+			continue
+		}
+		deadline, err := ocr.ParseDeadline(item.Deadline)
+		if err != nil || !deadline.After(now) {
+			continue
+		}
+
+		var nearest *Due
+		for _, offset := range offsets {
+			if now.Before(deadline.Add(-offset)) {
+				continue
+			}
+			key := firedKey(item, offset)
+			if _, ok := fired[key]; ok {
+				continue
+			}
+			fired[key] = now.Format(time.RFC3339)
+			if nearest == nil || offset < nearest.Offset {
+				nearest = &Due{Item: item, Offset: offset, Deadline: deadline}
+			}
+		}
+		if nearest != nil {
+			dues = append(dues, *nearest)
+		}
+	}
+	sort.Slice(dues, func(i, j int) bool { return dues[i].Deadline.Before(dues[j].Deadline) })
+	return dues
+}
+
+// Prune は期限を過ぎた課題の記録を削除します
+func (f Fired) Prune(now time.Time) {
+	for key := range f {
+		parts := strings.Split(key, "|")
+		if len(parts) < 3 {
+			delete(f, key)
+			continue
+		}
+		if deadline, err := ocr.ParseDeadline(parts[len(parts)-2]); err != nil || deadline.Before(now) {
+			delete(f, key)
+		}
+	}
+}
+
+// Format はリマインダーを通知用のテキストに整形します
+func Format(dues []Due, now time.Time) string {
+	var sb strings.Builder
+	for _, d := range dues {
+		sb.WriteString(fmt.Sprintf("⏰ %s（%s）\n   期限 %s（あと%s）\n", d.Item.Title, d.Item.Course, ocr.FormatDeadline(d.Item.Deadline), formatRemaining(d.Deadline.Sub(now))))
+		if d.Item.URL != "" {
+			sb.WriteString("   " + d.Item.URL + "\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func formatRemaining(d time.Duration) string {
+	hours := int(d.Round(time.Hour).Hours())
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%d分", int(d.Minutes()))
+	case hours < 24:
+		return fmt.Sprintf("%d時間", hours)
+	case hours%24 == 0:
+		return fmt.Sprintf("%d日", hours/24)
+	}
+	return fmt.Sprintf("%d日%d時間", hours/24, hours%24)
+}
+
+// Forget は課題に関する送信済みの記録をすべて削除します
+func (f Fired) Forget(key string) {
+	for k := range f {
+		if strings.HasPrefix(k, key+"|") {
+			delete(f, k)
+		}
+	}
+}
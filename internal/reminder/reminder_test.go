@@ -0,0 +1,185 @@
+package reminder
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"klms-go/internal/diff"
+	"klms-go/internal/ocr"
+	"klms-go/internal/storage"
+)
+
+var offsets = []time.Duration{72 * time.Hour, 24 * time.Hour, 3 * time.Hour}
+
+func item(key, deadline string) diff.Item {
+	return diff.Item{Key: key, Assignment: ocr.Assignment{Course: "情報処理", Title: "課題 " + key, Deadline: deadline}}
+}
+
+// at は日本時間の時刻です
+func at(s string) time.Time {
+	t, err := ocr.ParseDeadline(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestCheckFiresEachOffsetOnce(t *testing.T) {
+	items := []diff.Item{item("a", "2026-12-10 23:59")}
+	fired := Fired{}
+
+	// 各時点で送るべきオフセット（0 なら送らない）
+	steps := []struct {
+		now  string
+		want time.Duration
+	}{
+		{"2026-12-07 23:00", 0},              // 72時間前より前
+		{"2026-12-07 23:59", 72 * time.Hour}, // ちょうど72時間前
+		{"2026-12-08 12:00", 0},              // 送信済み
+		{"2026-12-09 23:59", 24 * time.Hour},
+		{"2026-12-10 00:00", 0},
+		{"2026-12-10 21:00", 3 * time.Hour},
+		{"2026-12-10 23:00", 0},
+		{"2026-12-11 00:00", 0}, // 期限後
+	}
+	for _, s := range steps {
+		dues := Check(items, offsets, fired, at(s.now))
+		var got time.Duration
+		if len(dues) > 1 {
+			t.Fatalf("%s: %d 件のリマインダー", s.now, len(dues))
+		}
+		if len(dues) == 1 {
+			got = dues[0].Offset
+		}
+		if got != s.want {
+			t.Errorf("%s: オフセット %v, want %v", s.now, got, s.want)
+		}
+	}
+	if len(fired) != len(offsets) {
+		t.Errorf("送信済みの記録: %v", fired)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	now := at("2026-12-10 12:00")
+	tests := []struct {
+		name  string
+		items []diff.Item
+		fired Fired
+		want  []time.Duration // 課題ごとに返るオフセット（期限の順）
+	}{
+		{
+			// 止まっていた間に過ぎたオフセットは、最も期限に近いものだけ送る（他は送信済みにする）
+			name:  "複数のオフセットを過ぎていた",
+			items: []diff.Item{item("a", "2026-12-10 14:00")},
+			fired: Fired{},
+			want:  []time.Duration{3 * time.Hour},
+		},
+		{
+			name:  "完了済みと期限切れは対象外",
+			items: []diff.Item{{Key: "done", Assignment: ocr.Assignment{Deadline: "2026-12-10 14:00", Completed: true}}, item("past", "2026-12-10 11:00"), item("bad", "未定")},
+			fired: Fired{},
+			want:  nil,
+		},
+		{
+			name:  "期限の順に並べる",
+			items: []diff.Item{item("late", "2026-12-12 12:00"), item("soon", "2026-12-10 13:00")},
+			fired: Fired{},
+			want:  []time.Duration{3 * time.Hour, 72 * time.Hour},
+		},
+		{
+			// 期限が変わると別のキーになり、新しい期限に対して改めて送る
+			name:  "期限の変更",
+			items: []diff.Item{item("a", "2026-12-11 10:00")},
+			fired: Fired{
+				"a|2026-12-10 14:00|72h0m0s": "2026-12-07T14:00:00+09:00",
+				"a|2026-12-10 14:00|24h0m0s": "2026-12-09T14:00:00+09:00",
+			},
+			want: []time.Duration{24 * time.Hour},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []time.Duration
+			for _, d := range Check(tt.items, offsets, tt.fired, now) {
+				got = append(got, d.Offset)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("オフセット %v, want %v", got, tt.want)
+			}
+			// 同じ時刻にもう一度確認しても送らない
+			if again := Check(tt.items, offsets, tt.fired, now); len(again) != 0 {
+				t.Errorf("2回目に %d 件のリマインダー", len(again))
+			}
+		})
+	}
+}
+
+func TestCheckIsNotRepeatedAfterRestart(t *testing.T) {
+	s, err := storage.Open(filepath.Join(t.TempDir(), "klms.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.SetDefault(s)
+
+	items := []diff.Item{item("a", "2026-12-10 23:59")}
+	now := at("2026-12-10 21:00")
+	fired := LoadFired()
+	if dues := Check(items, offsets, fired, now); len(dues) != 1 {
+		t.Fatalf("%d 件のリマインダー", len(dues))
+	}
+	if err := fired.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 再起動後（記録を読み直す）は同じリマインダーを送らない
+	reloaded := LoadFired()
+	if !reflect.DeepEqual(reloaded, fired) {
+		t.Errorf("保存した記録: %v, 読み込んだ記録: %v", fired, reloaded)
+	}
+	if dues := Check(items, offsets, reloaded, now.Add(time.Minute)); len(dues) != 0 {
+		t.Errorf("再起動後に %d 件のリマインダーを送りました", len(dues))
+	}
+}
+
+func TestPrune(t *testing.T) {
+	fired := Fired{
+		"a|2026-12-10 23:59|3h0m0s":  "x",
+		"a|2026-12-10 23:59|24h0m0s": "x",
+		"b|2026-12-09 12:00|3h0m0s":  "x",
+		"c|未定|3h0m0s":                "x",
+		"broken":                     "x",
+	}
+	fired.Prune(at("2026-12-10 00:00"))
+	want := Fired{"a|2026-12-10 23:59|3h0m0s": "x", "a|2026-12-10 23:59|24h0m0s": "x"}
+	if !reflect.DeepEqual(fired, want) {
+		t.Errorf("Prune 後: %v", fired)
+	}
+
+	fired.Prune(at("2026-12-11 00:00"))
+	if len(fired) != 0 {
+		t.Errorf("期限後も記録が残っています: %v", fired)
+	}
+}
+
+func TestForget(t *testing.T) {
+	fired := Fired{
+		"a|2026-12-10 23:59|3h0m0s":  "x",
+		"a|2026-12-09 23:59|24h0m0s": "x",
+		"ab|2026-12-10 23:59|3h0m0s": "x",
+		"b|2026-12-10 23:59|3h0m0s":  "x",
+	}
+	fired.Forget("a")
+	want := Fired{"ab|2026-12-10 23:59|3h0m0s": "x", "b|2026-12-10 23:59|3h0m0s": "x"}
+	if !reflect.DeepEqual(fired, want) {
+		t.Errorf("Forget 後: %v", fired)
+	}
+
+	// 忘れた課題は改めてリマインダーを送る
+	dues := Check([]diff.Item{item("a", "2026-12-10 23:59")}, offsets, fired, at("2026-12-10 21:00"))
+	if len(dues) != 1 {
+		t.Errorf("Forget 後に %d 件のリマインダー", len(dues))
+	}
+}
@@ -0,0 +1,80 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"klms-go/internal/browser"
+	"klms-go/internal/ocr"
+)
+
+// DOMSource はダッシュボードのプランナーをDOMから解析します（LLM不要）
+// 構造化データ（.planner-day）を優先し、取れない場合はテキスト（InnerText）を解析します
+type DOMSource struct{}
+
+func (s *DOMSource) Name() string { return NameDOM }
+
+func (s *DOMSource) Fetch(ctx context.Context, page *browser.CheckResult) (*Result, error) {
+	if page == nil {
+		return nil, fmt.Errorf("ダッシュボードの情報がありません")
+	}
+	now := time.Now()
+
+	if len(page.PlannerDays) > 0 {
+		assignments, err := ParsePlannerDays(page.PlannerDays, now)
+		if err == nil {
+			log.Printf("✅ プランナーのDOMから %d 件の課題を抽出しました", len(assignments))
+			return newResult(NameDOM, assignments), nil
+		}
+		log.Printf("⚠️ プランナーのDOMを解析できませんでした（テキスト解析を試します）: %v", err)
+	}
+
+	if page.BodyText == "" {
+		return nil, fmt.Errorf("ダッシュボードのテキストがありません")
+	}
+	assignments, err := ocr.ParsePlannerText(page.BodyText, now)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✅ ダッシュボードのテキストから %d 件の課題を抽出しました", len(assignments))
+	return newResult(NameDOM, assignments), nil
+}
+
+// ParsePlannerDays はプランナーの構造化データを課題一覧に変換します
+// 日付見出しや課題名が読み取れない場合は、レイアウトが変わったとみなしてエラーを返します
+func ParsePlannerDays(days []browser.PlannerDay, now time.Time) ([]ocr.Assignment, error) {
+	var assignments []ocr.Assignment
+	for _, day := range days {
+		date, ok := ocr.ParsePlannerDate(day.Heading, now)
+		if !ok {
+			return nil, fmt.Errorf("日付見出しを解釈できません: %q", day.Heading)
+		}
+		for _, item := range day.Items {
+			if item.Title == "" {
+				return nil, fmt.Errorf("課題名のない項目があります（%s）", day.Heading)
+			}
+			// 期限の時刻が表示されていない項目は23:59とみなす
+			hour, min, ok := ocr.ParseDueTime(item.Due)
+			if !ok {
+				hour, min = 23, 59
+			}
+			due := time.Date(date.Year(), date.Month(), date.Day(), hour, min, 0, 0, ocr.JST)
+
+			itemType := ocr.ItemType(item.Type)
+			if itemType == "" {
+				itemType = item.Type
+			}
+			assignments = append(assignments, ocr.Assignment{
+				Course:    item.Course,
+				Title:     item.Title,
+				Deadline:  due.Format(ocr.DeadlineLayout),
+				URL:       item.URL,
+				Type:      itemType,
+				Completed: item.Completed,
+			})
+		}
+	}
+	return assignments, nil
+}
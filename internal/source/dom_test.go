@@ -0,0 +1,76 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"klms-go/internal/browser"
+	"klms-go/internal/ocr"
+)
+
+func TestParsePlannerDays(t *testing.T) {
+	now := time.Date(2026, 12, 1, 10, 0, 0, 0, ocr.JST)
+	tests := []struct {
+		name    string
+		days    []browser.PlannerDay
+		want    []ocr.Assignment
+		wantErr bool
+	}{
+		{
+			name: "時刻・種別・完了を変換する",
+			days: []browser.PlannerDay{
+				{Heading: "12月3日 木曜日", Items: []browser.PlannerItem{
+					{Course: "情報処理", Title: "12月5日講義レポート", Type: "課題", URL: "https://lms.example/a/1", Due: "期限: 午後5:30"},
+					{Course: "経済学", Title: "確認テスト", Type: "Quiz", Due: "", Completed: true},
+				}},
+				{Heading: "Friday, December 4", Items: []browser.PlannerItem{
+					{Course: "English", Title: "Essay", Type: "peer_review", Due: "Due: 9:00 AM"},
+				}},
+			},
+			want: []ocr.Assignment{
+				{Course: "情報処理", Title: "12月5日講義レポート", Deadline: "2026-12-03 17:30", URL: "https://lms.example/a/1", Type: "assignment"},
+				{Course: "経済学", Title: "確認テスト", Deadline: "2026-12-03 23:59", Type: "quiz", Completed: true},
+				{Course: "English", Title: "Essay", Deadline: "2026-12-04 09:00", Type: "peer_review"},
+			},
+		},
+		{
+			name: "年をまたぐ見出し",
+			days: []browser.PlannerDay{
+				{Heading: "1月5日 火曜日", Items: []browser.PlannerItem{{Course: "情報処理", Title: "期末課題", Due: "23:00"}}},
+			},
+			want: []ocr.Assignment{
+				{Course: "情報処理", Title: "期末課題", Deadline: "2027-01-05 23:00"},
+			},
+		},
+		{
+			name:    "見出しが日付でない",
+			days:    []browser.PlannerDay{{Heading: "12月5日講義レポート"}},
+			wantErr: true,
+		},
+		{
+			name: "課題名がない",
+			days: []browser.PlannerDay{
+				{Heading: "今日", Items: []browser.PlannerItem{{Course: "情報処理", Due: "23:59"}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePlannerDays(tt.days, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("エラーになりません: %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"klms-go/internal/browser"
+	"klms-go/internal/config"
+	"klms-go/internal/ocr"
+)
+
+// 設定で指定できるソース名
+const (
+	NameCanvas    = "canvas"    // Canvas REST API
+	NameDOM       = "dom"       // ダッシュボードのテキストをルールベースで解析
+	NameGemini    = "gemini"    // スクリーンショット + Gemini OCR
+	NameTesseract = "tesseract" // スクリーンショット + ローカルのTesseract OCR
+	NameOpenAI    = "openai"    // スクリーンショット + OpenAI互換API（Ollamaなど）の画像入力
+	NameFixture   = "fixture"   // JSONファイル（CI・動作確認用）
+)
+
+// Result は課題ソースの取得結果です
+type Result struct {
+	Source      string           // 取得に成功したソース名
+	Assignments []ocr.Assignment // 構造化された課題一覧
+	Text        string           // 通知用テキスト
+	Fingerprint string           // 変更検知用のフィンガープリント
+}
+
+// AssignmentSource は課題一覧の取得元です
+// page はブラウザでのチェック結果で、ソースによっては使いません
+type AssignmentSource interface {
+	Name() string
+	Fetch(ctx context.Context, page *browser.CheckResult) (*Result, error)
+}
+
+// New は設定で指定されたソースを順に試すソースを作成します
+func New(cfg *config.Config) (AssignmentSource, error) {
+	var sources []AssignmentSource
+	for _, name := range cfg.AssignmentSources {
+		switch name {
+		case NameCanvas:
+			sources = append(sources, &CanvasSource{BaseURL: cfg.CanvasBaseURL, Token: cfg.CanvasToken, StateFile: browser.CookieFile})
+		case NameDOM:
+			sources = append(sources, &DOMSource{})
+		case NameGemini:
+			sources = append(sources, &GeminiSource{})
+		case NameTesseract:
+			sources = append(sources, &TesseractSource{Engine: &ocr.Tesseract{Path: cfg.TesseractPath, Language: cfg.TesseractLanguage}})
+		case NameOpenAI:
+			sources = append(sources, &OpenAISource{Engine: &ocr.OpenAICompatible{BaseURL: cfg.OpenAIBaseURL, Model: cfg.OpenAIModel, APIKey: cfg.OpenAIAPIKey}})
+		case NameFixture:
+			sources = append(sources, &FixtureSource{Path: cfg.SourceFixtureFile})
+		default:
+			return nil, fmt.Errorf("不明な課題ソースです: %s", name)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("課題ソースが指定されていません")
+	}
+	if len(sources) == 1 {
+		return sources[0], nil
+	}
+	return Chain(sources), nil
+}
+
+// Chain は先頭から順に試し、最初に成功したソースの結果を返します
+type Chain []AssignmentSource
+
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, s := range c {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c Chain) Fetch(ctx context.Context, page *browser.CheckResult) (*Result, error) {
+	chainErr := &ChainError{}
+	for _, s := range c {
+		result, err := s.Fetch(ctx, page)
+		if err == nil {
+			return result, nil
+		}
+		log.Printf("⚠️ 課題ソース「%s」で取得できませんでした（次のソースを試します）: %v", s.Name(), err)
+		chainErr.Names = append(chainErr.Names, s.Name())
+		chainErr.Errs = append(chainErr.Errs, err)
+	}
+	return nil, chainErr
+}
+
+// ChainError はすべてのソースで取得に失敗したことを表します
+// errors.Is でそれぞれのソースのエラー（ocr.ErrGeminiQuota など）を判定できます
+type ChainError struct {
+	Names []string
+	Errs  []error
+}
+
+func (e *ChainError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = fmt.Sprintf("%s: %v", e.Names[i], err)
+	}
+	return fmt.Sprintf("すべての課題ソースで取得に失敗しました（%s）", strings.Join(msgs, " / "))
+}
+
+func (e *ChainError) Unwrap() []error {
+	return e.Errs
+}
+
+// newResult は課題一覧から結果を組み立てます
+func newResult(name string, assignments []ocr.Assignment) *Result {
+	return &Result{
+		Source:      name,
+		Assignments: assignments,
+		Text:        ocr.FormatAssignments(assignments),
+		Fingerprint: Fingerprint(assignments, ""),
+	}
+}
+
+// Fingerprint は課題一覧の並び順に依存しないフィンガープリントを計算します
+// 課題を構造化できなかった場合は、正規化したテキストから計算します
+func Fingerprint(assignments []ocr.Assignment, text string) string {
+	var data []byte
+	if len(assignments) > 0 {
+		keys := make([]string, len(assignments))
+		for i, a := range assignments {
+			b, _ := json.Marshal([]interface{}{a.Course, a.Title, a.Deadline, a.Completed})
+			keys[i] = string(b)
+		}
+		sort.Strings(keys)
+		data = []byte(strings.Join(keys, "\n"))
+	} else {
+		data = []byte(NormalizeText(text))
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// NormalizeText は空白や改行を取り除いてテキストを比較しやすくします
+func NormalizeText(s string) string {
+	s = strings.ReplaceAll(s, " ", "")
+	s = strings.ReplaceAll(s, "　", "")
+	s = strings.ReplaceAll(s, "\n", "")
+	s = strings.ReplaceAll(s, "\r", "")
+	return s
+}
@@ -0,0 +1,53 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"klms-go/internal/browser"
+	"klms-go/internal/ocr"
+)
+
+// stubSource は決まった結果を返すソースです
+type stubSource struct {
+	name   string
+	result *Result
+	err    error
+}
+
+func (s *stubSource) Name() string { return s.name }
+
+func (s *stubSource) Fetch(ctx context.Context, page *browser.CheckResult) (*Result, error) {
+	return s.result, s.err
+}
+
+func TestChainReturnsFirstSuccess(t *testing.T) {
+	want := newResult(NameFixture, []ocr.Assignment{{Course: "情報処理", Title: "演習", Deadline: "2026-12-03 23:59"}})
+	chain := Chain{
+		&stubSource{name: NameDOM, err: errors.New("レイアウトを認識できません")},
+		&stubSource{name: NameFixture, result: want},
+	}
+	got, err := chain.Fetch(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("2番目のソースの結果が返されていません: %+v", got)
+	}
+}
+
+func TestChainErrorKeepsSourceErrors(t *testing.T) {
+	chain := Chain{
+		&stubSource{name: NameDOM, err: errors.New("レイアウトを認識できません")},
+		&stubSource{name: NameGemini, err: ocr.ErrGeminiQuota},
+	}
+	_, err := chain.Fetch(context.Background(), nil)
+	if !errors.Is(err, ocr.ErrGeminiQuota) {
+		t.Errorf("Geminiの使用上限を判定できません: %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "dom: レイアウトを認識できません") || !strings.Contains(msg, "gemini: ") {
+		t.Errorf("ソースごとのエラーがメッセージにありません: %s", msg)
+	}
+}
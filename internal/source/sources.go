@@ -0,0 +1,116 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"klms-go/internal/browser"
+	"klms-go/internal/canvas"
+	"klms-go/internal/ocr"
+)
+
+// CanvasSource はCanvas REST APIから課題を取得します
+type CanvasSource struct {
+	BaseURL   string
+	Token     string
+	StateFile string // Cookie認証に使うPlaywrightのセッション
+}
+
+func (s *CanvasSource) Name() string { return NameCanvas }
+
+func (s *CanvasSource) Fetch(ctx context.Context, page *browser.CheckResult) (*Result, error) {
+	log.Println("🛰️ Canvas APIから課題を取得します...")
+	client, err := canvas.NewClient(s.BaseURL, s.Token, s.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := client.FetchAssignments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✅ Canvas APIから %d 件の課題を取得しました（OCR不要）", len(assignments))
+	return newResult(NameCanvas, assignments), nil
+}
+
+// GeminiSource はスクリーンショットをGeminiでOCRします
+type GeminiSource struct{}
+
+func (s *GeminiSource) Name() string { return NameGemini }
+
+func (s *GeminiSource) Fetch(ctx context.Context, page *browser.CheckResult) (*Result, error) {
+	if page == nil || page.ScreenshotPath == "" {
+		return nil, fmt.Errorf("スクリーンショットがありません")
+	}
+	log.Println("🔍 OCRで詳細を確認します...")
+	text, assignments, err := ocr.ExtractAssignmentInfo(page.ScreenshotPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Source:      NameGemini,
+		Assignments: assignments,
+		Text:        text,
+		Fingerprint: Fingerprint(assignments, text),
+	}, nil
+}
+
+// TesseractSource はスクリーンショットをローカルのTesseractでOCRします（APIの使用回数を消費しません）
+// Geminiの後に指定すると、Geminiの使用上限に達した場合などの代わりになります
+type TesseractSource struct {
+	Engine *ocr.Tesseract
+}
+
+func (s *TesseractSource) Name() string { return NameTesseract }
+
+func (s *TesseractSource) Fetch(ctx context.Context, page *browser.CheckResult) (*Result, error) {
+	if page == nil || page.ScreenshotPath == "" {
+		return nil, fmt.Errorf("スクリーンショットがありません")
+	}
+	_, assignments, err := s.Engine.ExtractAssignments(ctx, page.ScreenshotPath)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(NameTesseract, assignments), nil
+}
+
+// OpenAISource はスクリーンショットをOpenAI互換API（Ollama・LM Studio・vLLMなど）の
+// 画像入力に対応したモデルで読み取ります（ローカルで動かせば使用回数の制限はありません）
+type OpenAISource struct {
+	Engine *ocr.OpenAICompatible
+}
+
+func (s *OpenAISource) Name() string { return NameOpenAI }
+
+func (s *OpenAISource) Fetch(ctx context.Context, page *browser.CheckResult) (*Result, error) {
+	if page == nil || page.ScreenshotPath == "" {
+		return nil, fmt.Errorf("スクリーンショットがありません")
+	}
+	_, assignments, err := s.Engine.ExtractAssignments(ctx, page.ScreenshotPath)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(NameOpenAI, assignments), nil
+}
+
+// FixtureSource はJSONファイルに保存した課題一覧を返します（CIや動作確認用）
+type FixtureSource struct {
+	Path string
+}
+
+func (s *FixtureSource) Name() string { return NameFixture }
+
+func (s *FixtureSource) Fetch(ctx context.Context, page *browser.CheckResult) (*Result, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("フィクスチャ読み込みエラー: %v", err)
+	}
+	var assignments []ocr.Assignment
+	if err := json.Unmarshal(data, &assignments); err != nil {
+		return nil, fmt.Errorf("フィクスチャ解析エラー: %v", err)
+	}
+	log.Printf("🧪 フィクスチャ %s から %d 件の課題を読み込みました", s.Path, len(assignments))
+	return newResult(NameFixture, assignments), nil
+}
@@ -3,16 +3,74 @@ package storage
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"sort"
+	"time"
 )
 
-const historyFile = "data/sent_history.json"
+// Status は課題の状態です
+type Status string
 
+const (
+	StatusOpen      Status = "open"      // 未提出
+	StatusSubmitted Status = "submitted" // 提出済み・完了済み
+	StatusRemoved   Status = "removed"   // 期限前に一覧から消えた
+	StatusExpired   Status = "expired"   // 提出しないまま期限を過ぎた
+)
+
+// HistoryRetention は消えた・期限切れ・提出済みの課題の記録を一覧で見なくなってから残す期間です
+const HistoryRetention = 30 * 24 * time.Hour
+
+// DeadlineChange は期限の変更の記録です
+type DeadlineChange struct {
+	Deadline  string    `json:"deadline"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Record は課題1件の記録です
+type Record struct {
+	Key      string `json:"key"`
+	Course   string `json:"course"`
+	Title    string `json:"title"`
+	Deadline string `json:"deadline"`
+	URL      string `json:"url,omitempty"`
+	Source   string `json:"source,omitempty"` // 最後に取得したソース（canvas, dom, gemini など）
+	Status   Status `json:"status"`
+
+	FirstSeen  time.Time  `json:"first_seen"`
+	LastSeen   time.Time  `json:"last_seen"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"` // 最後に通知した時刻（未通知なら nil）
+
+	// Sequence は最後にカレンダーへ出した予定の SEQUENCE です（取り消した予定を含む）
+	Sequence int `json:"sequence,omitempty"`
+
+	// DeadlineHistory は以前の期限です（古い順。現在の期限は含みません）
+	DeadlineHistory []DeadlineChange `json:"deadline_history,omitempty"`
+}
+
+// Observation は今回の一覧で見つかった課題です
+type Observation struct {
+	Key       string
+	Course    string
+	Title     string
+	Deadline  string
+	URL       string
+	Source    string
+	Completed bool
+	Overdue   bool // 期限を過ぎているか
+	Sequence  int  // カレンダーの SEQUENCE
+}
+
+// History は既知の課題の記録です
 type History struct {
-	SentIDs []string `json:"sent_ids"`
+	Records map[string]*Record `json:"records"`
+
+	// SentIDs は以前の形式の送信履歴（科目名・課題名・期限のハッシュ）です
+	// 一致する課題を見つけたら Records に移します
+	SentIDs []string `json:"sent_ids,omitempty"`
+
+	// ObservedAt は最後に一覧と照合した時刻です（LastSeen がこれと同じ記録が現在の一覧にある課題）
+	ObservedAt time.Time `json:"observed_at"`
 }
 
 // GenerateID は文字情報からIDを作ります（型への依存を排除）
@@ -23,43 +81,170 @@ func GenerateID(course, title, deadline string) string {
 }
 
 func LoadHistory() (*History, error) {
-	h := &History{SentIDs: []string{}}
-	if _, err := os.Stat(historyFile); os.IsNotExist(err) {
-		return h, nil
-	}
-	data, err := ioutil.ReadFile(historyFile)
-	if err != nil {
+	h := &History{}
+	if _, err := Load(BucketHistory, KeyHistory, h); err != nil {
 		return nil, err
 	}
-	if err := json.Unmarshal(data, h); err != nil {
-		return nil, err
+	if h.Records == nil {
+		h.Records = map[string]*Record{}
 	}
 	return h, nil
 }
 
 func (h *History) Save() error {
-	data, err := json.MarshalIndent(h, "", "  ")
-	if err != nil {
-		return err
+	return Update(h.Put)
+}
+
+// Put はトランザクション内で送信履歴を保存します
+func (h *History) Put(tx Tx) error {
+	return PutJSON(tx, BucketHistory, KeyHistory, h)
+}
+
+// Get は課題の記録を返します（なければ nil）
+func (h *History) Get(key string) *Record {
+	return h.Records[key]
+}
+
+// List は記録を期限の順に返します
+func (h *History) List() []*Record {
+	records := make([]*Record, 0, len(h.Records))
+	for _, r := range h.Records {
+		records = append(records, r)
 	}
-	os.MkdirAll("data", 0755)
-	return ioutil.WriteFile(historyFile, data, 0644)
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Deadline != records[j].Deadline {
+			return records[i].Deadline < records[j].Deadline
+		}
+		return records[i].Key < records[j].Key
+	})
+	return records
 }
 
-// IsNew も文字列を受け取るように変更
-func (h *History) IsNew(course, title, deadline string) bool {
+// Observe は今回の課題一覧で記録を更新します
+// 一覧にない課題は、期限を過ぎていれば expired、そうでなければ removed になります
+// expired は呼び出し側が期限を判定して返す関数です（一覧にない課題の判定に使います）
+func (h *History) Observe(observations []Observation, expired func(r *Record) bool, now time.Time) {
+	if h.Records == nil {
+		h.Records = map[string]*Record{}
+	}
+	seen := make(map[string]bool, len(observations))
+	for _, o := range observations {
+		seen[o.Key] = true
+		h.observe(o, now)
+	}
+	for key, r := range h.Records {
+		if seen[key] || (r.Status != StatusOpen && r.Status != StatusSubmitted) {
+			continue
+		}
+		switch {
+		case r.Status == StatusSubmitted:
+			// 提出済みの課題が一覧から消えるのは通常のことなので状態は変えない
+		case expired(r):
+			r.Status = StatusExpired
+		default:
+			r.Status = StatusRemoved
+		}
+	}
+	h.ObservedAt = now
+}
+
+func (h *History) observe(o Observation, now time.Time) {
+	r, ok := h.Records[o.Key]
+	if !ok {
+		r = &Record{Key: o.Key, FirstSeen: now}
+		h.Records[o.Key] = r
+		// 以前の形式の送信履歴にあれば通知済みとして引き継ぐ
+		if h.takeSentID(o.Course, o.Title, o.Deadline) {
+			r.NotifiedAt = &now
+		}
+	} else if r.Deadline != o.Deadline {
+		r.DeadlineHistory = append(r.DeadlineHistory, DeadlineChange{Deadline: r.Deadline, ChangedAt: now})
+	}
+
+	r.Course, r.Title, r.Deadline, r.URL = o.Course, o.Title, o.Deadline, o.URL
+	if o.Source != "" {
+		r.Source = o.Source
+	}
+	r.LastSeen = now
+	if o.Sequence > r.Sequence {
+		r.Sequence = o.Sequence
+	}
+	switch {
+	case o.Completed:
+		r.Status = StatusSubmitted
+	case o.Overdue:
+		r.Status = StatusExpired
+	default:
+		r.Status = StatusOpen
+	}
+}
+
+// Touch は課題一覧が前回と同じだった場合に、現在の一覧にある課題の LastSeen を更新します
+func (h *History) Touch(now time.Time) {
+	for _, r := range h.Records {
+		if r.LastSeen.Equal(h.ObservedAt) {
+			r.LastSeen = now
+		}
+	}
+	h.ObservedAt = now
+}
+
+// IsNotified は課題を通知済みかを返します
+// 記録がない場合は以前の形式の送信履歴（科目名・課題名・期限）で判定します
+func (h *History) IsNotified(key, course, title, deadline string) bool {
+	if r := h.Records[key]; r != nil {
+		return r.NotifiedAt != nil
+	}
 	id := GenerateID(course, title, deadline)
 	for _, sentID := range h.SentIDs {
 		if sentID == id {
-			return false
+			return true
 		}
 	}
+	return false
+}
+
+// MarkNotified は課題を通知済みとして記録します
+func (h *History) MarkNotified(key string, now time.Time) {
+	if r := h.Records[key]; r != nil {
+		t := now
+		r.NotifiedAt = &t
+	}
+}
+
+// Remove は課題の記録を削除します（次回は新規として扱われます）
+func (h *History) Remove(key string) bool {
+	r, ok := h.Records[key]
+	if !ok {
+		return false
+	}
+	h.takeSentID(r.Course, r.Title, r.Deadline)
+	delete(h.Records, key)
 	return true
 }
 
-// Add も文字列を受け取るように変更
-func (h *History) Add(course, title, deadline string) {
-	if h.IsNew(course, title, deadline) {
-		h.SentIDs = append(h.SentIDs, GenerateID(course, title, deadline))
+// Prune は一覧で最後に見てから retention を過ぎた課題の記録を削除し、削除した件数を返します
+// 未提出の課題は一覧から消えると removed・expired になるため、ここでは削除しません
+// 提出済みの課題は一覧から消えても状態が変わらないので、同じ期間で削除します
+func (h *History) Prune(now time.Time, retention time.Duration) int {
+	pruned := 0
+	for key, r := range h.Records {
+		if r.Status != StatusOpen && now.Sub(r.LastSeen) > retention {
+			delete(h.Records, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// takeSentID は以前の形式の送信履歴から一致するIDを取り除き、見つかったかを返します
+func (h *History) takeSentID(course, title, deadline string) bool {
+	id := GenerateID(course, title, deadline)
+	for i, sentID := range h.SentIDs {
+		if sentID == id {
+			h.SentIDs = append(h.SentIDs[:i], h.SentIDs[i+1:]...)
+			return true
+		}
 	}
-}
\ No newline at end of file
+	return false
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2026, 12, 1, 9, 0, 0, 0, JST)
+	old := now.Add(-HistoryRetention - time.Hour)
+	recent := now.Add(-time.Hour)
+	h := &History{Records: map[string]*Record{
+		"open":             {Key: "open", Status: StatusOpen, LastSeen: old},
+		"removed-old":      {Key: "removed-old", Status: StatusRemoved, LastSeen: old},
+		"expired-old":      {Key: "expired-old", Status: StatusExpired, LastSeen: old},
+		"submitted-old":    {Key: "submitted-old", Status: StatusSubmitted, LastSeen: old},
+		"submitted-recent": {Key: "submitted-recent", Status: StatusSubmitted, LastSeen: recent},
+		"removed-recent":   {Key: "removed-recent", Status: StatusRemoved, LastSeen: recent},
+	}}
+
+	if n := h.Prune(now, HistoryRetention); n != 3 {
+		t.Errorf("削除した件数: %d", n)
+	}
+	for _, key := range []string{"removed-old", "expired-old", "submitted-old"} {
+		if h.Get(key) != nil {
+			t.Errorf("%s が削除されていません", key)
+		}
+	}
+	for _, key := range []string{"open", "submitted-recent", "removed-recent"} {
+		if h.Get(key) == nil {
+			t.Errorf("%s が削除されました", key)
+		}
+	}
+}
+
+func TestObserveKeepsSubmittedUntilPruned(t *testing.T) {
+	now := time.Date(2026, 12, 1, 9, 0, 0, 0, JST)
+	h := &History{}
+	h.Observe([]Observation{{Key: "a", Course: "情報処理", Title: "演習", Deadline: "2026-11-20 23:59", Completed: true}}, nil, now)
+
+	// 提出済みの課題が一覧から消えても状態は変わらない
+	later := now.Add(HistoryRetention + time.Hour)
+	h.Observe(nil, func(*Record) bool { return true }, later)
+	if r := h.Get("a"); r == nil || r.Status != StatusSubmitted {
+		t.Fatalf("提出済みの記録: %+v", r)
+	}
+	if n := h.Prune(later, HistoryRetention); n != 1 || h.Get("a") != nil {
+		t.Errorf("一覧で見なくなってから期間を過ぎた提出済みの記録が削除されていません（%d 件削除）", n)
+	}
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// legacyFile は以前の形式（データベースと同じディレクトリのファイル）とデータベース内の保存先の対応です
+// 値の形式は同じなので内容をそのまま取り込みますが、JSONのファイルは先に Target に読み込んで壊れていないか確認します
+type legacyFile struct {
+	Name   string
+	Bucket string
+	Key    string
+	Target func() interface{} // JSONの読み込み先（nil ならテキストとしてそのまま取り込む）
+}
+
+// legacyGeminiCount はOCRが独自に記録していたGeminiの使用回数です（v1 まで）
+type legacyGeminiCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// legacyEntries は "entries" に配列を持つファイル（OCRキャッシュ・アウトボックス）の形です
+// 中身の型は他のパッケージにあるため、ここでは形だけを確認します
+type legacyEntries struct {
+	Entries []map[string]interface{} `json:"entries"`
+}
+
+var legacyFiles = []legacyFile{
+	{"sent_history.json", BucketHistory, KeyHistory, func() interface{} { return &History{} }},
+	{"daily_usage.json", BucketUsage, KeyDailyUsage, func() interface{} { return &DailyUsage{} }},
+	{"daily-gemini-count.json", BucketUsage, KeyGeminiCount, func() interface{} { return &legacyGeminiCount{} }},
+	{"ocr-cache.json", BucketCache, KeyOCRCache, func() interface{} { return &legacyEntries{} }},
+	{"last-run.txt", BucketState, KeyLastRun, nil},
+	{"last-ocr.txt", BucketState, KeyLastOCR, nil},
+	{"last-fingerprint.txt", BucketState, KeyLastFingerprint, nil},
+	{"last-timeout-notify.txt", BucketState, KeyLastTimeoutNotify, nil},
+	{"assignments.json", BucketAssignments, KeyAssignments, func() interface{} { return &[]map[string]interface{}{} }},
+	{"reminders.json", BucketReminders, KeyReminders, func() interface{} { return &map[string]string{} }},
+	{"outbox.json", BucketOutbox, KeyOutbox, func() interface{} { return &legacyEntries{} }},
+	{"caldav.json", BucketCalDAV, KeyCalDAV, func() interface{} { return &map[string]interface{}{} }},
+}
+
+// 各バケットの主なキー
+const (
+	KeyHistory     = "sent"
+	KeyDailyUsage  = "daily"
+	KeyGeminiCount = "gemini" // v1 まで（v2 で KeyDailyUsage にまとめました）
+	KeyOCRCache    = "ocr"
+	KeyAssignments = "items"
+	KeyReminders   = "fired"
+	KeyOutbox      = "entries"
+	KeyGmailDigest = "gmail-digest" // Gmailの上限到達後に保留したメッセージ（BucketOutbox）
+	KeyCalDAV      = "state"
+)
+
+// migrate はスキーマのバージョンを確認し、必要な移行を行います（Update のトランザクション内で呼ばれます）
+// dir は以前の形式のファイルがあるディレクトリです。取り込んだファイルを返します
+func migrate(tx Tx, dir string) ([]string, error) {
+	version, err := schemaVersion(tx)
+	if err != nil {
+		return nil, err
+	}
+	if version == SchemaVersion {
+		return nil, nil
+	}
+
+	var migrated []string
+	if version < 1 {
+		var err error
+		if migrated, err = importLegacyFiles(tx, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if version < 2 {
+		if err := mergeGeminiCount(tx); err != nil {
+			return nil, err
+		}
+	}
+
+	return migrated, tx.Put(BucketMeta, keySchemaVersion, []byte(strconv.Itoa(SchemaVersion)))
+}
+
+// schemaVersion はデータベースの形式のバージョンを返します（未作成なら0）
+// このプログラムより新しい形式の場合はエラーを返します
+func schemaVersion(tx Tx) (int, error) {
+	version := 0
+	if v := tx.Get(BucketMeta, keySchemaVersion); v != nil {
+		n, err := strconv.Atoi(string(v))
+		if err != nil {
+			return 0, fmt.Errorf("スキーマのバージョンが不正です: %q", v)
+		}
+		version = n
+	}
+	if version > SchemaVersion {
+		return 0, fmt.Errorf("データベースの形式（v%d）がこのプログラム（v%d）より新しいため使用できません", version, SchemaVersion)
+	}
+	return version, nil
+}
+
+// pendingLegacyFile は dir にあるまだ取り込んでいない以前の形式のファイルを返します（なければ空）
+func pendingLegacyFile(dir string) string {
+	for _, f := range legacyFiles {
+		path := filepath.Join(dir, f.Name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// importLegacyFiles は dir にある以前の形式のファイルをデータベースに取り込みます
+// 読み込めない・壊れているファイルは取り込まずに警告し、そのまま残します
+func importLegacyFiles(tx Tx, dir string) ([]string, error) {
+	var migrated []string
+	for _, f := range legacyFiles {
+		path := filepath.Join(dir, f.Name)
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("⚠️ %s を読み込めないため移行しません: %v", path, err)
+			continue
+		}
+		if f.Target != nil {
+			if err := json.Unmarshal(data, f.Target()); err != nil {
+				log.Printf("⚠️ %s が壊れているため移行しません（ファイルはそのまま残します）: %v", path, err)
+				continue
+			}
+		}
+		if err := tx.Put(f.Bucket, f.Key, data); err != nil {
+			return nil, err
+		}
+		migrated = append(migrated, path)
+	}
+	if len(migrated) > 0 {
+		log.Printf("📦 以前の形式のファイル %d 件をデータベースに移行しました", len(migrated))
+	}
+	return migrated, nil
+}
+
+// mergeGeminiCount はOCRが独自に記録していたGeminiの使用回数を、共通の使用回数（KeyDailyUsage）にまとめます（v2）
+func mergeGeminiCount(tx Tx) error {
+	var old legacyGeminiCount
+	found, err := GetJSON(tx, BucketUsage, KeyGeminiCount, &old)
+	if err != nil || !found {
+		return err
+	}
+	var usage DailyUsage
+	if _, err := GetJSON(tx, BucketUsage, KeyDailyUsage, &usage); err != nil {
+		return err
+	}
+	switch {
+	case old.Date > usage.Date:
+		usage = DailyUsage{Date: old.Date, GeminiCount: old.Count}
+	case old.Date == usage.Date && old.Count > usage.GeminiCount:
+		usage.GeminiCount = old.Count
+	}
+	if err := PutJSON(tx, BucketUsage, KeyDailyUsage, usage); err != nil {
+		return err
+	}
+	return tx.Delete(BucketUsage, KeyGeminiCount)
+}
+
+// renameMigrated は移行済みのファイルを *.migrated に名前を変えて残します（バックアップ用）
+func renameMigrated(paths []string) {
+	for _, path := range paths {
+		if err := os.Rename(path, path+".migrated"); err != nil {
+			log.Printf("⚠️ %s の名前を変更できませんでした: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Quota は1日あたりの使用回数に上限がある外部サービスです
+type Quota string
+
+const (
+	QuotaGemini Quota = "gemini"
+	QuotaLine   Quota = "line"
+	QuotaGmail  Quota = "gmail"
+)
+
+// Quotas は status などで表示する順です
+var Quotas = []Quota{QuotaGemini, QuotaLine, QuotaGmail}
+
+// QuotaConfig は使用回数の上限とリセット時刻です
+type QuotaConfig struct {
+	Limits  map[Quota]int
+	ResetAt int // 日本時間の0時からの分（この時刻に使用回数が0に戻ります）
+}
+
+// DefaultQuotaConfig は設定を読み込む前の既定値です
+var DefaultQuotaConfig = QuotaConfig{
+	Limits: map[Quota]int{QuotaGemini: 20, QuotaLine: 10, QuotaGmail: 50},
+}
+
+var quotaConfig = DefaultQuotaConfig
+
+// ConfigureQuotas は設定ファイルの上限とリセット時刻を反映します
+func ConfigureQuotas(c QuotaConfig) {
+	limits := map[Quota]int{}
+	for q, limit := range DefaultQuotaConfig.Limits {
+		limits[q] = limit
+	}
+	for q, limit := range c.Limits {
+		if limit > 0 {
+			limits[q] = limit
+		}
+	}
+	quotaConfig = QuotaConfig{Limits: limits, ResetAt: c.ResetAt}
+}
+
+// QuotaStatus は本日の使用状況です
+type QuotaStatus struct {
+	Quota   Quota
+	Used    int
+	Limit   int
+	ResetAt time.Time // 次に使用回数が0に戻る時刻
+}
+
+// Remaining は残りの回数です
+func (s QuotaStatus) Remaining() int {
+	if s.Used >= s.Limit {
+		return 0
+	}
+	return s.Limit - s.Used
+}
+
+func (s QuotaStatus) String() string {
+	return fmt.Sprintf("%d/%d (残り: %d回)", s.Used, s.Limit, s.Remaining())
+}
+
+// QuotaExceededError は上限に達している場合のエラーです
+type QuotaExceededError struct {
+	QuotaStatus
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("本日の%s使用上限(%d回)に達しました（%sにリセット）", quotaLabels[e.Quota], e.Limit, e.ResetAt.Format("01/02 15:04"))
+}
+
+var quotaLabels = map[Quota]string{QuotaGemini: "Gemini API", QuotaLine: "LINE送信", QuotaGmail: "Gmail送信"}
+
+// Reserve は外部サービスを1回使う前に使用回数を1増やします
+// 上限に達している場合は増やさずに *QuotaExceededError を返します
+// 呼び出しが失敗した場合は Release で戻してください
+func Reserve(q Quota) (QuotaStatus, error) {
+	var status QuotaStatus
+	err := Update(func(tx Tx) error {
+		now := time.Now()
+		data, err := getUsage(tx, now)
+		if err != nil {
+			return err
+		}
+		status = quotaStatus(q, data, now)
+		if status.Used >= status.Limit {
+			return &QuotaExceededError{status}
+		}
+		*data.count(q)++
+		status.Used++
+		return PutJSON(tx, BucketUsage, KeyDailyUsage, data)
+	})
+	return status, err
+}
+
+// Release は Reserve で増やした使用回数を戻します（外部サービスの呼び出しが失敗した場合）
+func Release(q Quota) {
+	err := Update(func(tx Tx) error {
+		data, err := getUsage(tx, time.Now())
+		if err != nil {
+			return err
+		}
+		if c := data.count(q); *c > 0 {
+			*c--
+		}
+		return PutJSON(tx, BucketUsage, KeyDailyUsage, data)
+	})
+	if err != nil {
+		log.Printf("⚠️ 使用回数の保存エラー: %v", err)
+	}
+}
+
+// QuotaStatusOf は本日の使用状況を返します（使用回数は増やしません）
+func QuotaStatusOf(q Quota) QuotaStatus {
+	return quotaStatus(q, LoadUsage(), time.Now())
+}
+
+func quotaStatus(q Quota, data DailyUsage, now time.Time) QuotaStatus {
+	return QuotaStatus{Quota: q, Used: *data.count(q), Limit: quotaConfig.Limits[q], ResetAt: nextQuotaReset(now)}
+}
+
+func (u *DailyUsage) count(q Quota) *int {
+	switch q {
+	case QuotaLine:
+		return &u.LineCount
+	case QuotaGmail:
+		return &u.GmailCount
+	}
+	return &u.GeminiCount
+}
+
+// usagePeriod はリセット時刻で区切った日付を返します
+func usagePeriod(now time.Time) string {
+	return now.In(JST).Add(-time.Duration(quotaConfig.ResetAt) * time.Minute).Format("2006-01-02")
+}
+
+// nextQuotaReset は次に使用回数が0に戻る時刻を返します
+func nextQuotaReset(now time.Time) time.Time {
+	t := now.In(JST)
+	reset := time.Date(t.Year(), t.Month(), t.Day(), 0, quotaConfig.ResetAt, 0, 0, JST)
+	if !reset.After(t) {
+		reset = reset.AddDate(0, 0, 1)
+	}
+	return reset
+}
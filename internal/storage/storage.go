@@ -1,19 +1,25 @@
 package storage
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"os"
+	"log"
 	"time"
 )
 
-// ファイルの保存場所
-const (
-	DataDir   = "data"
-	UsageFile = "data/daily_usage.json"
-)
+// データフォルダ
+const DataDir = "data"
+
+// JST は使用回数の日付の区切りに使うタイムゾーンです（tzdataがない環境では固定オフセット）
+var JST = loadJST()
+
+func loadJST() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Tokyo"); err == nil {
+		return loc
+	}
+	return time.FixedZone("JST", 9*60*60)
+}
 
 // まとめたデータ構造
+// Date はリセット時刻（QUOTA_RESET_TIME）で区切った日付です
 type DailyUsage struct {
 	Date               string `json:"date"`
 	GeminiCount        int    `json:"gemini_count"`
@@ -24,67 +30,50 @@ type DailyUsage struct {
 
 // データを読み込む（なければ作る）
 func LoadUsage() DailyUsage {
-	// 今日の日付
-	today := time.Now().Format("2006-01-02")
-	
-	defaultData := DailyUsage{
-		Date: today, GeminiCount: 0, LineCount: 0, GmailCount: 0, GmailLimitNotified: false,
-	}
-
-	// フォルダがない場合は作成（念のため）
-	if _, err := os.Stat(DataDir); os.IsNotExist(err) {
-		os.Mkdir(DataDir, 0755)
-	}
-
-	file, err := ioutil.ReadFile(UsageFile)
-	if err != nil {
-		return defaultData
-	}
-
 	var data DailyUsage
-	json.Unmarshal(file, &data)
-
-	// 日付が変わっていたらリセット
-	if data.Date != today {
-		data = defaultData
-		SaveUsage(data)
+	err := View(func(tx Tx) error {
+		var err error
+		data, err = getUsage(tx, time.Now())
+		return err
+	})
+	if err != nil {
+		log.Printf("⚠️ 使用回数の読み込みエラー: %v", err)
+		return DailyUsage{Date: usagePeriod(time.Now())}
 	}
-
 	return data
 }
 
 // データを保存する
 func SaveUsage(data DailyUsage) {
-	file, _ := json.MarshalIndent(data, "", "  ")
-	ioutil.WriteFile(UsageFile, file, 0644)
-}
-
-// --- 以下、各機能向けの便利関数 ---
-
-// Geminiのカウントを増やす
-func IncrementGemini() {
-	data := LoadUsage()
-	data.GeminiCount++
-	SaveUsage(data)
+	if err := Save(BucketUsage, KeyDailyUsage, data); err != nil {
+		log.Printf("⚠️ 使用回数の保存エラー: %v", err)
+	}
 }
 
-// LINEのカウントを増やす
-func IncrementLine() {
-	data := LoadUsage()
-	data.LineCount++
-	SaveUsage(data)
+// getUsage はトランザクション内で今日の使用回数を読み込みます（日付が変わっていればリセット）
+func getUsage(tx Tx, now time.Time) (DailyUsage, error) {
+	today := usagePeriod(now)
+	var data DailyUsage
+	found, err := GetJSON(tx, BucketUsage, KeyDailyUsage, &data)
+	if err != nil || !found || data.Date != today {
+		return DailyUsage{Date: today}, err
+	}
+	return data, nil
 }
 
-// Gmailのカウントを増やす
-func IncrementGmail() {
-	data := LoadUsage()
-	data.GmailCount++
-	SaveUsage(data)
-}
+// --- 以下、各機能向けの便利関数 ---
 
 // Gmailの終了通知フラグを立てる
 func MarkGmailLimitNotified() {
-	data := LoadUsage()
-	data.GmailLimitNotified = true
-	SaveUsage(data)
-}
\ No newline at end of file
+	err := Update(func(tx Tx) error {
+		data, err := getUsage(tx, time.Now())
+		if err != nil {
+			return err
+		}
+		data.GmailLimitNotified = true
+		return PutJSON(tx, BucketUsage, KeyDailyUsage, data)
+	})
+	if err != nil {
+		log.Printf("⚠️ 使用回数の保存エラー: %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DBFile は状態をまとめて保存するデータベースです
+const DBFile = "data/klms.db"
+
+// SchemaVersion はデータベースの形式のバージョンです
+// 形式を変える場合は上げて、migrate に移行処理を追加します
+const SchemaVersion = 2
+
+// バケット（テーブルに相当）
+const (
+	BucketMeta        = "meta"
+	BucketState       = "state"       // 前回の実行結果など小さな値（KeyLastRun など）
+	BucketHistory     = "history"     // 送信履歴
+	BucketUsage       = "usage"       // 1日あたりの使用回数
+	BucketCache       = "cache"       // OCRキャッシュなど
+	BucketAssignments = "assignments" // 前回取得した課題一覧
+	BucketReminders   = "reminders"   // 送信済みリマインダー
+	BucketOutbox      = "outbox"      // 未送信の通知
+	BucketCalDAV      = "caldav"      // CalDAVに登録したオブジェクト
+)
+
+// BucketState のキー
+const (
+	KeyLastRun           = "last-run"            // 前回の画面のハッシュ
+	KeyLastRunAt         = "last-run-at"         // 前回の実行時刻（RFC 3339）
+	KeyLastOCR           = "last-ocr"            // 前回の課題テキスト
+	KeyLastFingerprint   = "last-fingerprint"    // 前回の課題一覧のフィンガープリント
+	KeyLastTimeoutNotify = "last-timeout-notify" // 前回タイムアウトを通知した時刻
+	KeyLastQuotaNotify   = "last-quota-notify"   // Geminiの使用上限を通知したときのリセット時刻
+)
+
+const keySchemaVersion = "schema_version"
+
+var allBuckets = []string{
+	BucketMeta, BucketState, BucketHistory, BucketUsage, BucketCache,
+	BucketAssignments, BucketReminders, BucketOutbox, BucketCalDAV,
+}
+
+// Tx はトランザクションです
+type Tx interface {
+	Get(bucket, key string) []byte
+	Put(bucket, key string, value []byte) error
+	Delete(bucket, key string) error
+}
+
+// Store は状態を保存するデータベースです
+type Store interface {
+	// View は読み取り専用のトランザクションで fn を実行します
+	View(fn func(tx Tx) error) error
+	// Update は読み書きのトランザクションで fn を実行します
+	// fn がエラーを返した場合や途中で強制終了した場合、変更はすべて取り消されます
+	Update(fn func(tx Tx) error) error
+}
+
+// boltStore は bbolt による Store です
+// 常駐モードの実行中にも status などのコマンドを使えるよう、トランザクションごとにファイルを開いて閉じます
+// （bbolt は開いている間ファイルをロックするため）
+type boltStore struct {
+	path string
+}
+
+// LockTimeout は他のプロセスがデータベースを使っている場合に待つ最大時間です
+const LockTimeout = 30 * time.Second
+
+// Open はデータベースを開き、必要ならスキーマの作成と旧形式のファイルの移行を行います
+// 旧形式のファイルは path と同じディレクトリから探します
+func Open(path string) (Store, error) {
+	s := &boltStore{path: path}
+	var migrated []string
+	err := s.Update(func(tx Tx) error {
+		var err error
+		migrated, err = migrate(tx, filepath.Dir(path))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 取り込んだファイルは、トランザクションが確定してから名前を変える
+	renameMigrated(migrated)
+	return s, nil
+}
+
+// ReadOnly を true にすると、既定のデータベースを読み取り専用で開きます（--dry-run 用）
+// 最初にデータベースを使う前に設定してください
+var ReadOnly bool
+
+// ErrReadOnly は読み取り専用で開いたデータベースに書き込もうとしたことを表します
+var ErrReadOnly = errors.New("読み取り専用のため、データベースは変更しません")
+
+// OpenReadOnly はデータベースを読み取り専用で開きます
+// データベースの作成やスキーマの移行、以前の形式のファイルの取り込みは行いません
+// 移行が必要な場合は、ファイルを変更せずにエラーを返します
+func OpenReadOnly(path string) (Store, error) {
+	s := &readOnlyStore{path: path}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if legacy := pendingLegacyFile(filepath.Dir(path)); legacy != "" {
+			return nil, fmt.Errorf("以前の形式のファイル（%s）をデータベースに移行する必要があります。一度 --dry-run なしで実行してください", legacy)
+		}
+		return s, nil // 初回の実行（空のデータベースとして扱う）
+	}
+	var version int
+	err := s.View(func(tx Tx) error {
+		var err error
+		version, err = schemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if version < SchemaVersion {
+		return nil, fmt.Errorf("データベースの形式の移行（v%d → v%d）が必要です。一度 --dry-run なしで実行してください", version, SchemaVersion)
+	}
+	return s, nil
+}
+
+// readOnlyStore は読み取り専用の Store です（ファイルがなければ空として扱います）
+type readOnlyStore struct {
+	path string
+}
+
+func (s *readOnlyStore) View(fn func(tx Tx) error) error {
+	if _, err := os.Stat(s.path); os.IsNotExist(err) {
+		return fn(emptyTx{})
+	}
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: LockTimeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("データベース（%s）を開けません: %v", s.path, err)
+	}
+	defer db.Close()
+	return db.View(func(btx *bolt.Tx) error { return fn(&boltTx{btx}) })
+}
+
+func (s *readOnlyStore) Update(fn func(tx Tx) error) error {
+	return ErrReadOnly
+}
+
+// emptyTx はまだ作成されていないデータベースの読み取り用のトランザクションです
+type emptyTx struct{}
+
+func (emptyTx) Get(bucket, key string) []byte              { return nil }
+func (emptyTx) Put(bucket, key string, value []byte) error { return ErrReadOnly }
+func (emptyTx) Delete(bucket, key string) error            { return ErrReadOnly }
+
+func (s *boltStore) open(readOnly bool) (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, err
+	}
+	if readOnly {
+		if _, err := os.Stat(s.path); os.IsNotExist(err) {
+			readOnly = false // 読み取り専用では新規作成できない
+		}
+	}
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: LockTimeout, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("データベース（%s）を開けません: %v", s.path, err)
+	}
+	return db, nil
+}
+
+func (s *boltStore) View(fn func(tx Tx) error) error {
+	db, err := s.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(func(btx *bolt.Tx) error { return fn(&boltTx{btx}) })
+}
+
+func (s *boltStore) Update(fn func(tx Tx) error) error {
+	db, err := s.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(btx *bolt.Tx) error {
+		for _, name := range allBuckets {
+			if _, err := btx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return fn(&boltTx{btx})
+	})
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t *boltTx) Get(bucket, key string) []byte {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	v := b.Get([]byte(key))
+	if v == nil {
+		return nil
+	}
+	// 値はトランザクションの外では使えないのでコピーする
+	return append([]byte(nil), v...)
+}
+
+func (t *boltTx) Put(bucket, key string, value []byte) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return fmt.Errorf("バケット %s がありません", bucket)
+	}
+	return b.Put([]byte(key), value)
+}
+
+func (t *boltTx) Delete(bucket, key string) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(key))
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultStore Store
+	defaultErr   error
+)
+
+// Default は data/klms.db のデータベースを返します（初回に開いて移行を行います。ReadOnly なら移行しません）
+func Default() (Store, error) {
+	defaultOnce.Do(func() {
+		if ReadOnly {
+			defaultStore, defaultErr = OpenReadOnly(DBFile)
+		} else {
+			defaultStore, defaultErr = Open(DBFile)
+		}
+		if defaultErr != nil {
+			log.Printf("⚠️ %v", defaultErr)
+		}
+	})
+	return defaultStore, defaultErr
+}
+
+// SetDefault は既定のデータベースを s に差し替えます（テストで一時ディレクトリのデータベースを使う場合など）
+// ReadOnly や DBFile にかかわらず、以降の View・Update などは s を使います
+func SetDefault(s Store) {
+	defaultOnce.Do(func() {})
+	defaultStore, defaultErr = s, nil
+}
+
+// View は既定のデータベースで読み取り専用のトランザクションを実行します
+func View(fn func(tx Tx) error) error {
+	s, err := Default()
+	if err != nil {
+		return err
+	}
+	return s.View(fn)
+}
+
+// Update は既定のデータベースで読み書きのトランザクションを実行します
+func Update(fn func(tx Tx) error) error {
+	s, err := Default()
+	if err != nil {
+		return err
+	}
+	return s.Update(fn)
+}
+
+// GetJSON は値をJSONとして読み込みます（値がなければ false）
+func GetJSON(tx Tx, bucket, key string, v interface{}) (bool, error) {
+	data := tx.Get(bucket, key)
+	if data == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return true, fmt.Errorf("%s/%s の解析エラー: %v", bucket, key, err)
+	}
+	return true, nil
+}
+
+// PutJSON は値をJSONにして保存します
+func PutJSON(tx Tx, bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Put(bucket, key, data)
+}
+
+// Load は既定のデータベースから値をJSONとして読み込みます（値がなければ false）
+func Load(bucket, key string, v interface{}) (bool, error) {
+	var found bool
+	err := View(func(tx Tx) error {
+		var err error
+		found, err = GetJSON(tx, bucket, key, v)
+		return err
+	})
+	return found, err
+}
+
+// Save は既定のデータベースに値をJSONにして保存します
+func Save(bucket, key string, v interface{}) error {
+	return Update(func(tx Tx) error { return PutJSON(tx, bucket, key, v) })
+}
+
+// GetState は BucketState の値を文字列で返します（なければ空）
+func GetState(key string) string {
+	var value string
+	View(func(tx Tx) error {
+		value = string(tx.Get(BucketState, key))
+		return nil
+	})
+	return value
+}
+
+// PutState は BucketState に文字列を保存します
+func PutState(tx Tx, key, value string) error {
+	return tx.Put(BucketState, key, []byte(value))
+}
+
+// SetState は BucketState に文字列を保存します
+func SetState(key, value string) error {
+	return Update(func(tx Tx) error { return PutState(tx, key, value) })
+}
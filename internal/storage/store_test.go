@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// newV1Store は v1 の形式（Geminiの使用回数が別のキー）のデータベースを作ります
+func newV1Store(t *testing.T, path string) {
+	t.Helper()
+	s := &boltStore{path: path}
+	err := s.Update(func(tx Tx) error {
+		if err := tx.Put(BucketMeta, keySchemaVersion, []byte("1")); err != nil {
+			return err
+		}
+		if err := PutJSON(tx, BucketUsage, KeyGeminiCount, legacyGeminiCount{Date: "2026-12-01", Count: 7}); err != nil {
+			return err
+		}
+		return PutJSON(tx, BucketUsage, KeyDailyUsage, DailyUsage{Date: "2026-12-01", GeminiCount: 3, LineCount: 2})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenMigratesV1ToV2(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "klms.db")
+	newV1Store(t, path)
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.View(func(tx Tx) error {
+		if v, err := schemaVersion(tx); err != nil || v != SchemaVersion {
+			t.Errorf("スキーマのバージョン: %d, %v", v, err)
+		}
+		if tx.Get(BucketUsage, KeyGeminiCount) != nil {
+			t.Error("v1 のGeminiの使用回数が残っています")
+		}
+		var usage DailyUsage
+		if _, err := GetJSON(tx, BucketUsage, KeyDailyUsage, &usage); err != nil {
+			return err
+		}
+		// 同じ日なら多い方の回数を残す
+		want := DailyUsage{Date: "2026-12-01", GeminiCount: 7, LineCount: 2}
+		if usage != want {
+			t.Errorf("使用回数: %+v, want %+v", usage, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenRejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "klms.db")
+	s := &boltStore{path: path}
+	s.Update(func(tx Tx) error {
+		return tx.Put(BucketMeta, keySchemaVersion, []byte(strconv.Itoa(SchemaVersion+1)))
+	})
+	if _, err := Open(path); err == nil {
+		t.Error("新しい形式のデータベースを開けてしまいます")
+	}
+}
+
+func TestOpenImportsLegacyFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("sent_history.json", `{"records":{},"sent_ids":["abc"]}`)
+	write("last-run.txt", "hash-1")
+	write("reminders.json", `{"a": ["壊れている"`)        // JSONとして壊れている
+	write("daily_usage.json", `["形が違う"]`)            // DailyUsage ではない
+	write("outbox.json", `{"entries":"not-a-list"}`) // entries が配列ではない
+
+	s, err := Open(filepath.Join(dir, "klms.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.View(func(tx Tx) error {
+		var h History
+		if found, err := GetJSON(tx, BucketHistory, KeyHistory, &h); !found || err != nil || len(h.SentIDs) != 1 {
+			t.Errorf("送信履歴が取り込まれていません: %+v, %v", h, err)
+		}
+		if got := string(tx.Get(BucketState, KeyLastRun)); got != "hash-1" {
+			t.Errorf("前回のハッシュ: %q", got)
+		}
+		for _, k := range [][2]string{{BucketReminders, KeyReminders}, {BucketUsage, KeyDailyUsage}, {BucketOutbox, KeyOutbox}} {
+			if tx.Get(k[0], k[1]) != nil {
+				t.Errorf("壊れたファイルが %s/%s に取り込まれました", k[0], k[1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"sent_history.json", "last-run.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name+".migrated")); err != nil {
+			t.Errorf("%s の名前が変わっていません: %v", name, err)
+		}
+	}
+	for _, name := range []string{"reminders.json", "daily_usage.json", "outbox.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("壊れたファイル %s が残っていません: %v", name, err)
+		}
+	}
+}
+
+func TestUpdateRollsBackOnError(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "klms.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(func(tx Tx) error { return PutState(tx, KeyLastRun, "before") }); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("途中で失敗")
+	err = s.Update(func(tx Tx) error {
+		if err := PutState(tx, KeyLastRun, "after"); err != nil {
+			return err
+		}
+		if err := PutState(tx, KeyLastFingerprint, "fp"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("エラーが返されていません: %v", err)
+	}
+	s.View(func(tx Tx) error {
+		if got := string(tx.Get(BucketState, KeyLastRun)); got != "before" {
+			t.Errorf("変更が取り消されていません: %q", got)
+		}
+		if tx.Get(BucketState, KeyLastFingerprint) != nil {
+			t.Error("失敗したトランザクションの値が保存されています")
+		}
+		return nil
+	})
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	t.Run("データベースがなければ空として扱い、作成しない", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "klms.db")
+		s, err := OpenReadOnly(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.View(func(tx Tx) error {
+			if tx.Get(BucketState, KeyLastRun) != nil {
+				t.Error("空のデータベースに値があります")
+			}
+			return nil
+		})
+		if err := s.Update(func(tx Tx) error { return nil }); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("書き込みがエラーになりません: %v", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("データベースが作成されました: %v", err)
+		}
+	})
+
+	t.Run("以前の形式のファイルがあれば移行せずにエラー", func(t *testing.T) {
+		dir := t.TempDir()
+		legacy := filepath.Join(dir, "sent_history.json")
+		ioutil.WriteFile(legacy, []byte(`{"records":{}}`), 0644)
+		if _, err := OpenReadOnly(filepath.Join(dir, "klms.db")); err == nil {
+			t.Error("移行が必要なのにエラーになりません")
+		}
+		if _, err := os.Stat(legacy); err != nil {
+			t.Errorf("以前の形式のファイルが変更されました: %v", err)
+		}
+	})
+
+	t.Run("古い形式のデータベースは移行せずにエラー", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "klms.db")
+		newV1Store(t, path)
+		before, _ := ioutil.ReadFile(path)
+		if _, err := OpenReadOnly(path); err == nil {
+			t.Error("移行が必要なのにエラーになりません")
+		}
+		if after, _ := ioutil.ReadFile(path); string(before) != string(after) {
+			t.Error("データベースが変更されました")
+		}
+	})
+
+	t.Run("最新の形式なら読み込める", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "klms.db")
+		s, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Update(func(tx Tx) error { return PutState(tx, KeyLastRun, "hash-1") })
+
+		ro, err := OpenReadOnly(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ro.View(func(tx Tx) error {
+			if got := string(tx.Get(BucketState, KeyLastRun)); got != "hash-1" {
+				t.Errorf("前回のハッシュ: %q", got)
+			}
+			return nil
+		})
+		if err := ro.Update(func(tx Tx) error { return nil }); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("書き込みがエラーになりません: %v", err)
+		}
+	})
+}
+
+func TestSetDefault(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "klms.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(s)
+	if err := SetState(KeyLastRun, "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetState(KeyLastRun); got != "hash-1" {
+		t.Errorf("既定のデータベースが差し替わっていません: %q", got)
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,10 +17,14 @@ import (
 	"github.com/joho/godotenv"
 
 	"klms-go/internal/browser"
+	"klms-go/internal/caldav"
 	"klms-go/internal/config"
+	"klms-go/internal/diff"
 	"klms-go/internal/ics"
 	"klms-go/internal/notify"
 	"klms-go/internal/ocr"
+	"klms-go/internal/reminder"
+	"klms-go/internal/source"
 	"klms-go/internal/storage"
 )
 
@@ -30,11 +38,17 @@ const (
 // ファイルパスは計算が必要なので変数(var)にします
 var (
 	LogFile     = filepath.Join(LogDir, "run-log.txt")
-	LastRunFile = filepath.Join(DataDir, "last-run.txt")
-	LastOcrFile = filepath.Join(DataDir, "last-ocr.txt")
 	ScheduleFile = "schedule.ics" // これは添付用の一時ファイルなのでルートでOK
+	CancelFile   = "schedule-cancel.ics" // 削除された課題の予定を取り消すファイル
 )
 
+// notifiers は設定から作成した通知チャネルの一覧です
+var notifiers = &notify.Registry{}
+
+// dryRun が true の場合、ブラウザ操作とOCRは行いますが、通知は送らずに標準出力へ表示し、
+// 送信履歴・前回の実行結果・使用回数などの状態ファイルも更新しません
+var dryRun bool
+
 func main() {
 	// === 0. フォルダ作成 (なければ作る) ===
 	if err := os.MkdirAll(LogDir, 0755); err != nil {
@@ -49,34 +63,94 @@ func main() {
 	if err != nil {
 		log.Printf("ログファイルオープンエラー: %v", err)
 	} else {
-		defer f.Close()
 		mw := io.MultiWriter(os.Stdout, f)
 		log.SetOutput(mw)
 	}
 
+	// === 2. 環境変数の読み込み ===
+	if err := godotenv.Load(); err != nil {
+		log.Printf("⚠️ .envファイルの読み込みに失敗しました（環境変数から直接読み込みます）: %v", err)
+	}
+
+	// === サブコマンドの実行（引数なしは run） ===
+	code := runCLI(os.Args[1:])
+	if f != nil {
+		f.Close()
+	}
+	os.Exit(code)
+}
+
+// setupMonitor は run / daemon に共通の準備（設定・通知チャネル・課題ソース）を行います
+func setupMonitor() (*config.Config, source.AssignmentSource, bool) {
 	log.Println("------------------------------------------------")
 	log.Println("🚀 K-LMS監視を開始します: ", time.Now().Format("2006-01-02 15:04:05"))
 
-	// === 2. 環境変数と設定の読み込み ===
-	if err := godotenv.Load(); err != nil {
-		log.Printf("⚠️ .envファイルの読み込みに失敗しました（環境変数から直接読み込みます）: %v", err)
+	// dry-runではデータベースを読み取り専用で開き、移行（以前の形式のファイルの取り込みなど）もしない
+	storage.ReadOnly = dryRun
+	if _, err := storage.Default(); err != nil {
+		log.Printf("❌ データベースを開けません: %v", err)
+		return nil, nil, false
 	}
-	
+
+	// 読み込みに失敗した設定は途中までしか埋まっていないため、上限や通知先に使わない
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		reportError(fmt.Sprintf("設定の読み込みに失敗しました: %v", err))
-		return
+		return nil, nil, false
+	}
+	storage.ConfigureQuotas(cfg.Quotas())
+	notifiers = notify.NewRegistry(cfg)
+	notifiers.RunID = newRunID()
+	if outbox, err := notify.LoadOutbox(notify.OutboxDir); err != nil {
+		log.Printf("⚠️ アウトボックスの読み込みエラー（再送なしで送信します）: %v", err)
+	} else {
+		notifiers.Outbox = outbox
 	}
-	log.Printf("✅ 設定の読み込み完了（Gemini API制限: %d回/日）", cfg.MaxGeminiPerDay)
+	if dryRun {
+		log.Println("🧪 dry-runモード: 通知は送信せず標準出力に表示し、状態ファイルは更新しません")
+		notifiers = notifiers.DryRun(os.Stdout)
+		ocr.DryRun = true
+	}
+	log.Printf("✅ 設定の読み込み完了（1日あたりの上限: Gemini %d回・LINE %d回・Gmail %d回）", cfg.MaxGeminiPerDay, cfg.MaxLinePerDay, cfg.MaxGmailPerDay)
 
-	// === 3. 前回ハッシュ読み込み ===
-	oldHash := ""
-	if data, err := ioutil.ReadFile(LastRunFile); err == nil {
-		oldHash = string(data)
+	src, err := source.New(cfg)
+	if err != nil {
+		reportError(fmt.Sprintf("課題ソースの設定エラー: %v", err))
+		return nil, nil, false
 	}
+	log.Printf("🔌 課題ソース: %s", src.Name())
+	return cfg, src, true
+}
+
+// checkFunc はK-LMSを開いて変化を確認する関数です（単発実行と常駐モードで差し替える）
+type checkFunc func(oldHash string) (*browser.CheckResult, error)
+
+// runOnce は1回分のチェックを行います
+func runOnce(cfg *config.Config, src source.AssignmentSource, check checkFunc) {
+	// 前回までに送れなかった通知を再送
+	notifiers.Flush(context.Background())
+
+	checkAssignments(cfg, src, check)
+
+	// CalDAVのカレンダーに課題を反映（設定されている場合のみ）
+	syncCalDAV(cfg, false)
+
+	// === 6. 締切リマインダー（変化の有無にかかわらず毎回） ===
+	sendReminders(cfg)
+}
+
+// checkAssignments はK-LMSを確認し、課題に変化があれば通知します
+func checkAssignments(cfg *config.Config, src source.AssignmentSource, check checkFunc) {
+	var err error
+
+	// === 3. 前回ハッシュ読み込み ===
+	oldHash := storage.GetState(storage.KeyLastRun)
 
 	// === 4. ブラウザ操作 ===
-	result, err := browser.CheckKLMSTask(oldHash)
+	result := &browser.CheckResult{HasDiff: true}
+	if cfg.NeedsBrowser() {
+		result, err = check(oldHash)
+	}
 	if err != nil {
 		// タイムアウトエラーの場合は、致命的なエラーとして扱わずにログに記録
 		errMsg := err.Error()
@@ -99,122 +173,358 @@ func main() {
 
 	// === 5. 結果処理 ===
 	if result.HasDiff {
-		log.Println("📸 画像変化検知。OCRで詳細を確認します...")
+		log.Println("📸 画面の変化を検知。課題の詳細を確認します...")
 
-		ocrText, assignments, err := ocr.ExtractAssignmentInfo(result.ScreenshotPath)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		fetched, err := src.Fetch(ctx, result)
+		cancel()
+		if errors.Is(err, ocr.ErrGeminiQuota) {
+			// 上限に達している間は取得失敗として扱わない
+			// 前回のハッシュは更新しないので、リセット後のチェックで同じ画面の変化から課題を取得し直す
+			log.Printf("⏸️ %v。使用回数のリセット後に課題を取得し直します", err)
+			notifyGeminiQuota(err)
+			return
+		}
 		if err != nil {
-			log.Printf("⚠️ OCRエラー: %v", err)
-			// OCRエラーでも通知は送信（画像のみ）
-			notify.SendGmail("【K-LMSエラー】OCR処理失敗", 
-				fmt.Sprintf("画像の変化は検知しましたが、OCR処理でエラーが発生しました。\n\nエラー内容: %v\n\nスクリーンショットを添付します。", err), 
+			log.Printf("⚠️ 課題取得エラー: %v", err)
+			// 取得エラーでも通知は送信（画像のみ）
+			sendAlert("【K-LMSエラー】課題の取得失敗", 
+				fmt.Sprintf("画面の変化は検知しましたが、課題の取得でエラーが発生しました。\n\nエラー内容: %v\n\nスクリーンショットを添付します。", err), 
 				[]string{result.ScreenshotPath})
 			return
 		}
+		ocrText, assignments := fetched.Text, fetched.Assignments
+
+		// 前回フィンガープリントの読み込み
+		lastFingerprint := storage.GetState(storage.KeyLastFingerprint)
 
-		// 前回テキストの読み込み
-		lastOcrText := ""
-		if data, err := ioutil.ReadFile(LastOcrFile); err == nil {
-			lastOcrText = string(data)
+		// 課題の記録（初めて見た日時・通知した日時・期限の変更履歴など）
+		checkedAt := time.Now()
+		history, err := storage.LoadHistory()
+		if err != nil {
+			log.Printf("⚠️ 課題の記録の読み込みエラー: %v", err)
+			history = &storage.History{Records: map[string]*storage.Record{}}
 		}
 
-		// テキスト内容の比較
-		if normalizeText(ocrText) == normalizeText(lastOcrText) {
-			log.Println("🧘 課題内容（テキスト）に変更はありませんでした。")
-			ioutil.WriteFile(LastRunFile, []byte(result.Hash), 0644)
+		// 課題内容の比較
+		if fetched.Fingerprint == lastFingerprint {
+			log.Println("🧘 課題内容に変更はありませんでした。")
+			history.Touch(checkedAt)
+			commitState(func(tx storage.Tx) error {
+				if err := history.Put(tx); err != nil {
+					return err
+				}
+				return storage.PutState(tx, storage.KeyLastRun, result.Hash)
+			})
 			return
 		}
 
+		// === 差分の検出 ===
+		// 課題を構造化できなかった場合（OCRのJSON解析失敗など）はテキストをそのまま通知する
+		summary := ocrText
+		var snapshot []diff.Item
+		var changes []diff.Change
+		if assignments != nil {
+			prev, err := diff.LoadSnapshot()
+			if err != nil {
+				log.Printf("⚠️ 前回の課題一覧の読み込みエラー（全件を新規として扱います）: %v", err)
+			}
+			// 期限切れ・提出済みの記録がある同じ名前の課題（毎週の小テストなど）は別の課題として扱う
+			taken := func(key string, a ocr.Assignment) bool {
+				r := history.Get(key)
+				return r != nil && (r.Status == storage.StatusExpired || r.Status == storage.StatusSubmitted) && r.Deadline != a.Deadline
+			}
+			changes, snapshot = diff.Compare(prev, assignments, taken, checkedAt)
+			diff.Reappear(history, changes, snapshot)
+			if len(changes) == 0 {
+				log.Println("🧘 課題の追加・変更はありませんでした。")
+				diff.RecordHistory(history, snapshot, nil, fetched.Source, checkedAt)
+				commitState(func(tx storage.Tx) error {
+					if err := diff.PutSnapshot(tx, snapshot); err != nil {
+						return err
+					}
+					if err := history.Put(tx); err != nil {
+						return err
+					}
+					if err := storage.PutState(tx, storage.KeyLastRun, result.Hash); err != nil {
+						return err
+					}
+					return storage.PutState(tx, storage.KeyLastFingerprint, fetched.Fingerprint)
+				})
+				return
+			}
+			summary = diff.Summary(changes)
+			log.Printf("🔔 課題の変更を %d 件検出しました！\n%s", len(changes), summary)
+		} else {
+			log.Println("🔔 課題の変更を検出しました！")
+		}
+
 		// === ここから変更通知フロー ===
-		log.Println("🔔 新しい課題を検出しました！")
 		now := time.Now().Format("2006-01-02 15:04")
 
-		// --- 重複防止フィルタリング ---
-		history, _ := storage.LoadHistory()
-		var newAssignments []ocr.Assignment
-
-		for _, task := range assignments {
-			if history.IsNew(task.Course, task.Title, task.Deadline) {
-				newAssignments = append(newAssignments, task)
-				history.Add(task.Course, task.Title, task.Deadline)
-			}
-		}
+		// --- カレンダーに登録・更新・取り消す課題 ---
+		// 新しい課題は課題の記録で重複を防ぎ、期限などが変わった課題は同じUIDの新しい版（SEQUENCE+1）を作る
+		calendarItems, cancelledItems := calendarUpdates(changes, snapshot, history)
 
 		// --- 添付ファイル準備 ---
 		var attachments []string
 		attachments = append(attachments, result.ScreenshotPath)
 
-		// 新規課題がある場合のみICS作成
-		if len(newAssignments) > 0 {
-			log.Printf("📅 新規課題が %d 件あります。.icsを作成します...", len(newAssignments))
-			
-			icsContent := ics.GenerateICS(newAssignments)
-			
-			if err := ioutil.WriteFile(ScheduleFile, []byte(icsContent), 0644); err == nil {
-				attachments = append(attachments, ScheduleFile)
-			}
-			history.Save()
-		} else {
+		icsOpts := ics.NewOptions(cfg)
+		if len(calendarItems) > 0 {
+			log.Printf("📅 カレンダーに登録・更新する課題が %d 件あります。.icsを作成します...", len(calendarItems))
+			attachments = writeCalendar(ScheduleFile, ics.GenerateICS(calendarItems, icsOpts), attachments)
+		}
+		if len(cancelledItems) > 0 {
+			log.Printf("🗑️ 削除された課題が %d 件あります。予定を取り消す.icsを作成します...", len(cancelledItems))
+			attachments = writeCalendar(CancelFile, ics.GenerateCancelICS(cancelledItems, icsOpts), attachments)
+		}
+		if len(calendarItems) == 0 && len(cancelledItems) == 0 {
 			log.Println("🧘 既出の課題なので、カレンダーファイルは作成しません。")
 		}
 
-		// === ① LINE通知 ===
-		log.Println("💬 LINE送信中...")
-		lineMsg := fmt.Sprintf("📚 K-LMS課題通知\n\n%s\n\n📅 %s\n(詳細はメールを確認してください)", ocrText, now)
-		if err := notify.SendLINE(lineMsg); err != nil {
-			log.Printf("⚠️ LINE送信エラー: %v", err)
-			// LINE送信エラーは致命的ではないので続行
-		} else {
-			log.Println("✅ LINE送信完了")
+		// === 通知（LINE・Gmailなど有効な全チャネル） ===
+		mailBody := fmt.Sprintf("課題の変更を検出しました。\n\n%s\n\n📅 検知時刻: %s", summary, now)
+		if assignments != nil {
+			mailBody += fmt.Sprintf("\n\n📋 現在の課題一覧\n%s", ocrText)
 		}
-
-		// === ② Gmail通知 ===
-		log.Println("📧 Gmail送信中...")
-		mailBody := fmt.Sprintf("課題を検出しました。\n\n%s\n\n📅 検知時刻: %s", ocrText, now)
 		
-		if len(newAssignments) > 0 {
-			mailBody += "\n\n✨ 新しい課題が含まれていたため、カレンダー登録用ファイルを添付しました。"
-		} else {
+		if len(calendarItems) > 0 {
+			mailBody += "\n\n✨ 新しい課題・変更された課題のカレンダー登録用ファイルを添付しました。以前に取り込んだ予定は上書きされます。"
+		}
+		if len(cancelledItems) > 0 {
+			mailBody += fmt.Sprintf("\n\n🗑️ 削除された課題の予定を取り消すファイル（%s）を添付しました。", CancelFile)
+		}
+		if len(calendarItems) == 0 && len(cancelledItems) == 0 {
 			mailBody += "\n\n(※新しい課題はないため、カレンダーファイルは添付していません)"
 		}
 
-		if err := notify.SendGmail("【K-LMS】課題通知", mailBody, attachments); err != nil {
-			log.Printf("⚠️ Gmail送信エラー: %v", err)
-			// Gmail送信エラーは致命的ではないので続行
-		} else {
-			log.Println("✅ Gmail送信完了")
+		// 送信エラーは致命的ではないので続行
+		notifiers.Send(context.Background(), notify.Message{
+			Event:       notify.EventAssignmentsChanged,
+			Subject:     "【K-LMS】課題通知",
+			Body:        mailBody,
+			Summary:     fmt.Sprintf("%s\n\n📅 %s\n(詳細はメールを確認してください)", summary, now),
+			Attachments: attachments,
+			Assignments: assignments,
+			Changes:     changes,
+		})
+
+		// 課題の記録を更新し、今回通知した課題に通知日時を記録
+		if snapshot != nil {
+			diff.RecordHistory(history, snapshot, changes, fetched.Source, checkedAt)
+			for _, c := range changes {
+				history.MarkNotified(c.Key, checkedAt)
+			}
 		}
 
-		// 完了処理
-		ioutil.WriteFile(LastRunFile, []byte(result.Hash), 0644)
-		ioutil.WriteFile(LastOcrFile, []byte(ocrText), 0644)
+		// 完了処理（課題一覧・課題の記録・前回の結果をまとめて保存）
+		commitState(func(tx storage.Tx) error {
+			if snapshot != nil {
+				if err := diff.PutSnapshot(tx, snapshot); err != nil {
+					return err
+				}
+			}
+			if err := history.Put(tx); err != nil {
+				return err
+			}
+			for key, value := range map[string]string{
+				storage.KeyLastRun:         result.Hash,
+				storage.KeyLastOCR:         ocrText,
+				storage.KeyLastFingerprint: fetched.Fingerprint,
+			} {
+				if err := storage.PutState(tx, key, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 		log.Println("🎉 全工程完了")
 
 	} else {
 		log.Println("✅ 変化なし")
+		commitState(nil)
 	}
 }
 
-func normalizeText(s string) string {
-	s = strings.ReplaceAll(s, " ", "")
-	s = strings.ReplaceAll(s, "　", "")
-	s = strings.ReplaceAll(s, "\n", "")
-	s = strings.ReplaceAll(s, "\r", "")
-	return s
+// calendarUpdates は差分から、カレンダーに登録・更新する課題と取り消す課題を返します
+// 新しい課題はまだ通知していない場合だけ含めます（一度削除された課題が再び現れた場合は予定を登録し直します）
+func calendarUpdates(changes []diff.Change, snapshot []diff.Item, history *storage.History) ([]diff.Item, []diff.Item) {
+	current := make(map[string]diff.Item, len(snapshot))
+	for _, item := range snapshot {
+		current[item.Key] = item
+	}
+
+	var updated, cancelled []diff.Item
+	seen := map[string]bool{}
+	for _, c := range changes {
+		if seen[c.Key] {
+			continue
+		}
+		switch c.Kind {
+		case diff.Removed:
+			cancelled = append(cancelled, diff.Item{Key: c.Key, Assignment: *c.Old, Sequence: c.Sequence})
+		case diff.Added:
+			if r := history.Get(c.Key); r != nil && r.Status == storage.StatusRemoved {
+				updated = append(updated, current[c.Key])
+				break
+			}
+			if history.IsNotified(c.Key, c.New.Course, c.New.Title, c.New.Deadline) {
+				continue
+			}
+			updated = append(updated, current[c.Key])
+		default:
+			updated = append(updated, current[c.Key])
+		}
+		seen[c.Key] = true
+	}
+	return updated, cancelled
+}
+
+// writeCalendar はカレンダーファイルを書き出して添付ファイルに加えます（dry-runでは標準出力に表示します）
+func writeCalendar(path, content string, attachments []string) []string {
+	if dryRun {
+		fmt.Printf("===== [dry-run] %s =====\n%s\n", path, content)
+		return attachments
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		log.Printf("⚠️ %s の書き込みエラー: %v", path, err)
+		return attachments
+	}
+	return append(attachments, path)
+}
+
+// commitState は実行結果を1つのトランザクションで保存します（dry-runでは保存しません）
+// 途中で強制終了しても、課題一覧・送信履歴・前回の結果が食い違った状態にはなりません
+func commitState(fn func(tx storage.Tx) error) {
+	if dryRun {
+		return
+	}
+	err := storage.Update(func(tx storage.Tx) error {
+		if err := storage.PutState(tx, storage.KeyLastRunAt, time.Now().Format(time.RFC3339)); err != nil {
+			return err
+		}
+		if fn == nil {
+			return nil
+		}
+		return fn(tx)
+	})
+	if err != nil {
+		log.Printf("⚠️ 実行結果の保存エラー: %v", err)
+	}
+}
+
+// newRunID は実行ごとのIDを作ります（ログやWebhookで実行を区別するため）
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// sendReminders は既知の課題の締切が近づいていればリマインダーを送ります
+func sendReminders(cfg *config.Config) {
+	if len(cfg.ReminderOffsets) == 0 {
+		return
+	}
+	items, err := diff.LoadSnapshot()
+	if err != nil {
+		log.Printf("⚠️ 課題一覧の読み込みエラー（リマインダーをスキップします）: %v", err)
+		return
+	}
+
+	now := time.Now()
+	fired := reminder.LoadFired()
+	fired.Prune(now)
+	dues := reminder.Check(items, cfg.ReminderOffsets, fired, now)
+	if len(dues) == 0 {
+		if !dryRun {
+			fired.Save()
+		}
+		return
+	}
+
+	log.Printf("⏰ 締切が近い課題が %d 件あります。リマインダーを送信します...", len(dues))
+	text := reminder.Format(dues, now)
+	var dueAssignments []ocr.Assignment
+	for _, d := range dues {
+		dueAssignments = append(dueAssignments, d.Item.Assignment)
+	}
+	results := notifiers.Send(context.Background(), notify.Message{
+		Event:       notify.EventReminder,
+		Subject:     "【K-LMS】締切リマインダー",
+		Body:        fmt.Sprintf("締切が近づいている課題があります。\n\n%s", text),
+		Summary:     text,
+		Assignments: dueAssignments,
+	})
+
+	// アウトボックスがあれば失敗分はそちらで再送される
+	// ない場合にどのチャネルでも送れなかったときは記録せず、次回に再送する
+	if dryRun || (notifiers.Outbox == nil && !notify.AnySucceeded(results)) {
+		return
+	}
+	fired.Save()
+	log.Println("✅ リマインダー送信完了")
+}
+
+// syncCalDAV は既知の課題をCalDAVのカレンダーに反映します
+// 課題一覧が更新されたときと、前回の照合から ResyncInterval が過ぎたときだけサーバーに問い合わせます
+func syncCalDAV(cfg *config.Config, force bool) error {
+	if cfg.CalDAVURL == "" {
+		return nil
+	}
+	if dryRun {
+		log.Println("🧪 dry-runのためCalDAVへの反映をスキップします")
+		return nil
+	}
+	state := caldav.LoadState()
+	if !force && !state.NeedsSync(diff.SnapshotUpdatedAt(), time.Now()) {
+		return nil
+	}
+
+	items, err := diff.LoadSnapshot()
+	if err != nil {
+		log.Printf("⚠️ 課題一覧の読み込みエラー（CalDAVへの反映をスキップします）: %v", err)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	client := caldav.NewClient(cfg.CalDAVURL, cfg.CalDAVUser, cfg.CalDAVPass)
+	result, err := client.Sync(ctx, items, ics.NewOptions(cfg), state)
+	if saveErr := state.Save(); saveErr != nil {
+		log.Printf("⚠️ CalDAVの記録の保存エラー: %v", saveErr)
+	}
+	if err != nil {
+		log.Printf("⚠️ CalDAVへの反映エラー（次回再試行します）: %v", err)
+		return err
+	}
+	if result != (caldav.SyncResult{}) {
+		log.Printf("🗓️ CalDAVに反映しました（%s）", result)
+	}
+	return nil
 }
 
 func reportError(errMsg string) {
 	log.Printf("❌ 致命的なエラー: %s", errMsg)
-	notify.SendGmail("【K-LMSエラー】監視システム停止", errMsg, nil)
+	sendAlert("【K-LMSエラー】監視システム停止", errMsg, nil)
+}
+
+// sendAlert はエラー・警告をメール（とWebhook）で通知します
+func sendAlert(subject, body string, attachments []string) {
+	notifiers.Only("gmail", "webhook").Send(context.Background(), notify.Message{
+		Event:       notify.EventError,
+		Subject:     subject,
+		Body:        body,
+		Attachments: attachments,
+	})
 }
 
 // notifyTimeoutError はタイムアウトエラーを通知します（1時間に1回まで）
 func notifyTimeoutError(err error) {
-	timeoutNotifyFile := "data/last-timeout-notify.txt"
 	now := time.Now()
 	
 	// 前回の通知時刻を確認
-	if data, err := ioutil.ReadFile(timeoutNotifyFile); err == nil {
-		if lastNotify, err := time.Parse(time.RFC3339, string(data)); err == nil {
+	if data := storage.GetState(storage.KeyLastTimeoutNotify); data != "" {
+		if lastNotify, err := time.Parse(time.RFC3339, data); err == nil {
 			if now.Sub(lastNotify) < time.Hour {
 				// 1時間以内に通知済みの場合はスキップ
 				return
@@ -223,10 +533,29 @@ func notifyTimeoutError(err error) {
 	}
 	
 	// 通知を送信
-	notify.SendGmail("【K-LMS警告】タイムアウトエラー", 
+	sendAlert("【K-LMS警告】タイムアウトエラー", 
 		fmt.Sprintf("K-LMSへのアクセスでタイムアウトエラーが発生しました。\n\nエラー内容: %v\n\nK-LMSの応答が遅い可能性があります。システムは次回の実行時に再試行します。", err), 
 		nil)
 	
 	// 通知時刻を記録
-	ioutil.WriteFile(timeoutNotifyFile, []byte(now.Format(time.RFC3339)), 0644)
+	if !dryRun {
+		storage.SetState(storage.KeyLastTimeoutNotify, now.Format(time.RFC3339))
+	}
+}
+
+// notifyGeminiQuota はGemini APIの使用上限に達して課題を取得できなかったことを通知します
+// 通知は使用回数のリセットごとに1回だけです
+func notifyGeminiQuota(err error) {
+	resetAt := storage.QuotaStatusOf(storage.QuotaGemini).ResetAt
+	if storage.GetState(storage.KeyLastQuotaNotify) == resetAt.Format(time.RFC3339) {
+		return
+	}
+
+	sendAlert("【K-LMS警告】Gemini APIの使用上限",
+		fmt.Sprintf("画面の変化を検知しましたが、Gemini APIの1日あたりの使用上限に達しているため課題を取得できませんでした。\n\nエラー内容: %v\n\n%s 以降のチェックで課題を取得し直します。", err, resetAt.Format("01/02 15:04")),
+		nil)
+
+	if !dryRun {
+		storage.SetState(storage.KeyLastQuotaNotify, resetAt.Format(time.RFC3339))
+	}
 }
\ No newline at end of file